@@ -0,0 +1,46 @@
+package endpoint
+
+import (
+	"context"
+	"net"
+)
+
+type remoteAddrKey struct{}
+
+// LocalAddr returns the local address of the connection, or nil if the
+// endpoint runs over a Transport without one.
+func (ep *endpoint) LocalAddr() net.Addr {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.conn == nil {
+		return nil
+	}
+	return ep.conn.LocalAddr()
+}
+
+// RemoteAddr returns the peer's address, or nil if the endpoint runs over
+// a Transport without a connection.
+func (ep *endpoint) RemoteAddr() net.Addr {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	if ep.conn == nil {
+		return nil
+	}
+	return ep.conn.RemoteAddr()
+}
+
+// withRemoteAddr adds the peer's address, if known, to a handler's ctx.
+func (ep *endpoint) withRemoteAddr(ctx context.Context) context.Context {
+	addr := ep.RemoteAddr()
+	if addr == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteAddrKey{}, addr)
+}
+
+// RemoteAddrFromContext returns the address of the caller of the request
+// being handled under ctx. Handler interceptors get the same ctx.
+func RemoteAddrFromContext(ctx context.Context) (addr net.Addr, ok bool) {
+	addr, ok = ctx.Value(remoteAddrKey{}).(net.Addr)
+	return
+}
@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestAddrsOverTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	seen := make(chan net.Addr, 1)
+	servers := make(chan *ServerConn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		sc := NewServerConn(conn, nil, WithHandlerInterceptor(
+			func(ctx context.Context, method string, arg interface{}, next func() error) error {
+				addr, _ := RemoteAddrFromContext(ctx)
+				seen <- addr
+				return next()
+			}))
+		sc.Register(new(Arith))
+		servers <- sc
+		sc.Serve()
+	}()
+
+	c, err := DialContext(context.Background(), "tcp", l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	sc := <-servers
+	defer sc.Close()
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	local, remote := c.LocalAddr(), sc.RemoteAddr()
+	if local == nil || remote == nil {
+		t.Fatalf("LocalAddr = %v, RemoteAddr = %v", local, remote)
+	}
+	if local.String() != remote.String() {
+		t.Fatalf("client LocalAddr %v does not match server RemoteAddr %v", local, remote)
+	}
+	if addr := <-seen; addr == nil || addr.String() != local.String() {
+		t.Fatalf("interceptor saw caller %v, want %v", addr, local)
+	}
+	if got := c.ep.RemoteAddr(); got.String() != l.Addr().String() {
+		t.Fatalf("client RemoteAddr = %v, want the dialed %v", got, l.Addr())
+	}
+}
@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"context"
+
+	"github.com/ugorji/go/codec"
+)
+
+// ArrayIter walks the elements of an array reply one at a time. The reply
+// is held in its encoded form, so only the element being decoded is ever
+// materialized.
+type ArrayIter struct {
+	dec *codec.Decoder
+	n   int
+	i   int
+	err error
+}
+
+// CallArrayStream is Call for methods replying with a large array, which
+// it returns as an iterator instead of decoding it at once. A nil reply is
+// an empty array.
+func (ep *endpoint) CallArrayStream(method string, params ...interface{}) (it *ArrayIter, err error) {
+	var body codec.Raw
+	req := &request{typed: true, into: &body}
+	if _, err = ep.roundTrip(context.Background(), req, method, params, ep.await); err != nil {
+		return
+	}
+	it = new(ArrayIter)
+	if len(body) == 0 {
+		return
+	}
+	n, rest, err := readArrayLen(body)
+	if err != nil {
+		return nil, err
+	}
+	it.n = n
+	it.dec = codec.NewDecoderBytes(rest, ep.mpk)
+	return
+}
+
+// Next decodes the next element into dst, a pointer. It returns false at
+// the end of the array or on a decode error, which Err then reports.
+func (it *ArrayIter) Next(dst interface{}) bool {
+	if it.err != nil || it.i >= it.n {
+		return false
+	}
+	if it.err = it.dec.Decode(dst); it.err != nil {
+		return false
+	}
+	it.i++
+	return true
+}
+
+// Len returns the number of elements in the array.
+func (it *ArrayIter) Len() int {
+	return it.n
+}
+
+// Err returns the error that stopped Next, if any.
+func (it *ArrayIter) Err() error {
+	return it.err
+}
@@ -0,0 +1,48 @@
+package endpoint
+
+import (
+	"runtime"
+	"testing"
+)
+
+type Big int
+
+func (*Big) Range(n int, reply *[]int) error {
+	*reply = make([]int, n)
+	for i := range *reply {
+		(*reply)[i] = i
+	}
+	return nil
+}
+
+func TestCallArrayStream(t *testing.T) {
+	const n = 100000
+	c, _ := newPair(t, new(Big), nil)
+	it, err := c.CallArrayStream("Big.Range", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	// Elements are decoded one by one into v, so walking the reply
+	// allocates next to nothing, where decoding it whole would allocate
+	// for every element.
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var v int
+	for it.Next(&v) {
+		if v != count {
+			t.Fatalf("element %d = %d", count, v)
+		}
+		count++
+	}
+	runtime.ReadMemStats(&after)
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != n {
+		t.Fatalf("iterated %d elements, want %d", count, n)
+	}
+	if allocs := after.Mallocs - before.Mallocs; allocs > n/100 {
+		t.Fatalf("iterating %d elements allocated %d times", n, allocs)
+	}
+}
@@ -0,0 +1,56 @@
+package endpoint
+
+import (
+	"github.com/ugorji/go/codec"
+)
+
+// AuditKind is the type of message an AuditRecord describes.
+type AuditKind int
+
+const (
+	AuditRequest  AuditKind = iota // a call from the peer; Params is set
+	AuditNotify                    // a notification from the peer; Params is set
+	AuditResponse                  // the peer's answer to a call; Error or Result is set
+)
+
+// AuditRecord describes one message decoded by the read loop. Params,
+// Error and Result are decoded afresh for the record, so the hook owns them
+// and nothing it does affects dispatch.
+type AuditRecord struct {
+	Kind   AuditKind
+	MsgID  uint32 // zero for notifications
+	Method string // for responses, the method of the matching call
+	Params interface{}
+	Error  interface{}
+	Result interface{}
+}
+
+// WithAuditHook calls fn with every request, notification and response
+// the endpoint receives, after it is decoded and before it is dispatched.
+// fn runs on the read loop and must not block.
+func WithAuditHook(fn func(AuditRecord)) Option {
+	return func(ep *endpoint) {
+		ep.auditHook = fn
+	}
+}
+
+func (ep *endpoint) audit(kind AuditKind, msgid uint32, method string, params, rerr, result codec.Raw) {
+	if ep.auditHook == nil {
+		return
+	}
+	rec := AuditRecord{Kind: kind, MsgID: msgid, Method: method}
+	rec.Params = ep.auditValue(params)
+	rec.Error = ep.auditValue(rerr)
+	rec.Result = ep.auditValue(result)
+	ep.auditHook(rec)
+}
+
+func (ep *endpoint) auditValue(raw codec.Raw) (v interface{}) {
+	if len(raw) == 0 {
+		return
+	}
+	if err := codec.NewDecoderBytes(raw, ep.mpk).Decode(&v); err != nil {
+		v = nil
+	}
+	return
+}
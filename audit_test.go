@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"testing"
+)
+
+func TestAuditHook(t *testing.T) {
+	var srvRecs, cliRecs []AuditRecord
+	srvHook := WithAuditHook(func(rec AuditRecord) {
+		// Scribbling on the record must not change what is dispatched.
+		if p, ok := rec.Params.([]interface{}); ok && len(p) > 0 {
+			p[0] = "tampered"
+		}
+		srvRecs = append(srvRecs, rec)
+	})
+	c, _ := newPair(t, new(Arith), []Option{srvHook},
+		WithAuditHook(func(rec AuditRecord) { cliRecs = append(cliRecs, rec) }))
+	rsp, err := c.Call("Arith.Multiply", Args{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 6 {
+		t.Fatalf("rsp = %v, want 6", rsp)
+	}
+
+	if len(srvRecs) != 1 || srvRecs[0].Kind != AuditRequest || srvRecs[0].Method != "Arith.Multiply" {
+		t.Fatalf("server saw %+v, want the request", srvRecs)
+	}
+	if len(cliRecs) != 1 || cliRecs[0].Kind != AuditResponse || cliRecs[0].Method != "Arith.Multiply" ||
+		cliRecs[0].MsgID != srvRecs[0].MsgID || cliRecs[0].Result != int64(6) {
+		t.Fatalf("client saw %+v, want the response", cliRecs)
+	}
+}
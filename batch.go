@@ -0,0 +1,116 @@
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+type replyBatcher struct {
+	mu     sync.Mutex
+	window time.Duration
+	msgs   [][]byte
+}
+
+// WithReplyBatching holds each encoded reply for up to d so that replies
+// to pipelined requests completing close together go out in one write.
+// Every reply is still a message of its own, answering its msgid.
+func WithReplyBatching(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.batch.window = d
+	}
+}
+
+// queueReply adds msg to the current batch, starting a new batch that is
+// flushed after the window if there is none.
+func (ep *endpoint) queueReply(msg []byte) {
+	b := &ep.batch
+	b.mu.Lock()
+	b.msgs = append(b.msgs, msg)
+	first := len(b.msgs) == 1
+	b.mu.Unlock()
+	if first {
+		time.AfterFunc(b.window, ep.flushReplies)
+	}
+}
+
+// flushReplies writes the batched replies.
+func (ep *endpoint) flushReplies() {
+	b := &ep.batch
+	b.mu.Lock()
+	msgs := b.msgs
+	b.msgs = nil
+	b.mu.Unlock()
+	if len(msgs) == 0 {
+		return
+	}
+	if err := ep.write(msgs...); err != nil {
+		ep.logger.Printf("rpc: writing batched replies: %v", err)
+	}
+}
+
+// BatchCall is one call of a CallBatch.
+type BatchCall struct {
+	Method string
+	Params []interface{}
+}
+
+// BatchResult is the outcome of a BatchCall.
+type BatchResult struct {
+	Reply interface{}
+	Err   error
+}
+
+// CallBatch sends calls with a single write and waits for all of their
+// replies, for at most the timeout set with WithCallTimeout from the
+// moment the batch is sent; calls still unanswered then fail with
+// ErrCallTimeout. results[i] is the outcome of calls[i]; replies may
+// arrive in any order. Call interceptors are not run.
+func (ep *endpoint) CallBatch(calls []BatchCall) (results []BatchResult) {
+	results = make([]BatchResult, len(calls))
+	reqs := make([]*request, len(calls))
+	msgs := make([][]byte, 0, len(calls))
+	for i, c := range calls {
+		req := new(request)
+		msg, err := ep.prepare(req, c.Method, c.Params)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		reqs[i] = req
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) > 0 {
+		if err := ep.write(msgs...); err != nil {
+			for i, req := range reqs {
+				if req != nil {
+					ep.takePending(req.msgid)
+					reqs[i], results[i].Err = nil, err
+				}
+			}
+		}
+	}
+	var deadline <-chan time.Time
+	if ep.callTimeout > 0 {
+		t := time.NewTimer(ep.callTimeout)
+		defer t.Stop()
+		deadline = t.C
+	}
+	expired := false
+	for i, req := range reqs {
+		if req == nil {
+			continue
+		}
+		if !expired {
+			select {
+			case <-req.done:
+			case <-deadline:
+				expired = true
+			}
+		}
+		if expired {
+			ep.abandon(req, ErrCallTimeout)
+		}
+		results[i].Reply, results[i].Err = ep.wait(req)
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeCounter is a net.Conn counting its writes.
+type writeCounter struct {
+	net.Conn
+	writes int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+// pipelined makes n concurrent calls through a server set up with
+// srvOpts, checks every reply and returns how many writes the server
+// made.
+func pipelined(tb testing.TB, n int, srvOpts ...Option) int64 {
+	a, b := net.Pipe()
+	conn := &writeCounter{Conn: b}
+	sc := NewServerConn(conn, nil, srvOpts...)
+	sc.Register(new(Arith))
+	go sc.Serve()
+	c := NewClient(a, nil)
+	defer func() {
+		c.Close()
+		sc.Close()
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rsp, err := c.Call("Arith.Multiply", Args{i, 3})
+			if err != nil {
+				tb.Error(err)
+				return
+			}
+			if m, _ := rsp.(int64); m != int64(3*i) {
+				tb.Errorf("call %d: rsp = %v, want %d", i, rsp, 3*i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return atomic.LoadInt64(&conn.writes)
+}
+
+func TestReplyBatching(t *testing.T) {
+	if writes := pipelined(t, 100, WithReplyBatching(5*time.Millisecond)); writes >= 100 {
+		t.Fatalf("%d writes for 100 batched replies", writes)
+	}
+}
+
+func BenchmarkPipelinedReplyWrites(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"unbatched", nil},
+		{"batched", []Option{WithReplyBatching(time.Millisecond)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var writes int64
+			for i := 0; i < b.N; i++ {
+				writes += pipelined(b, 100, bc.opts...)
+			}
+			b.ReportMetric(float64(writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+// countedClient is newPair with the client's writes counted.
+func countedClient(tb testing.TB) (*Client, *writeCounter) {
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil)
+	sc.Register(new(Arith))
+	go sc.Serve()
+	conn := &writeCounter{Conn: a}
+	c := NewClient(conn, nil)
+	tb.Cleanup(func() {
+		c.Close()
+		sc.Close()
+	})
+	return c, conn
+}
+
+func TestCallBatch(t *testing.T) {
+	c, conn := countedClient(t)
+	calls := []BatchCall{
+		{"Arith.Multiply", []interface{}{Args{2, 3}}},
+		{"Arith.Divide", []interface{}{Args{1, 0}}},
+		{"Arith.Nope", []interface{}{Args{1, 1}}},
+		{"Arith.Divide", []interface{}{Args{8, 2}}},
+	}
+	results := c.CallBatch(calls)
+	if len(results) != len(calls) {
+		t.Fatalf("%d results for %d calls", len(results), len(calls))
+	}
+	if n, _ := results[0].Reply.(int64); results[0].Err != nil || n != 6 {
+		t.Errorf("results[0] = %+v, want 6", results[0])
+	}
+	if err := results[1].Err; err == nil || err.Error() != "divide by zero" {
+		t.Errorf("results[1] = %+v, want divide by zero", results[1])
+	}
+	if err := results[2].Err; err == nil || err.Error() != "rpc: can't find method Arith.Nope" {
+		t.Errorf("results[2] = %+v, want an unknown method", results[2])
+	}
+	if n, _ := results[3].Reply.(int64); results[3].Err != nil || n != 4 {
+		t.Errorf("results[3] = %+v, want 4", results[3])
+	}
+	if w := atomic.LoadInt64(&conn.writes); w != 1 {
+		t.Fatalf("%d writes for a batch, want 1", w)
+	}
+}
+
+func BenchmarkCallBatchWrites(b *testing.B) {
+	calls := make([]BatchCall, 100)
+	for i := range calls {
+		calls[i] = BatchCall{"Arith.Multiply", []interface{}{Args{i, 2}}}
+	}
+	b.Run("batch", func(b *testing.B) {
+		c, conn := countedClient(b)
+		for i := 0; i < b.N; i++ {
+			c.CallBatch(calls)
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+	})
+	b.Run("calls", func(b *testing.B) {
+		c, conn := countedClient(b)
+		for i := 0; i < b.N; i++ {
+			var wg sync.WaitGroup
+			for _, call := range calls {
+				wg.Add(1)
+				go func(call BatchCall) {
+					defer wg.Done()
+					c.Call(call.Method, call.Params...)
+				}(call)
+			}
+			wg.Wait()
+		}
+		b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+	})
+}
+
+func TestCallBatchDeadline(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	c, _ := newPair(t, new(Sleeper), nil, WithCallTimeout(timeout))
+	// Each reply comes less than the timeout after the one before it, but
+	// the last one well after the timeout since the batch was sent.
+	var calls []BatchCall
+	for _, d := range []time.Duration{0, 60 * time.Millisecond, 120 * time.Millisecond, 180 * time.Millisecond} {
+		calls = append(calls, BatchCall{"Sleeper.Sleep", []interface{}{int64(d)}})
+	}
+	start := time.Now()
+	results := c.CallBatch(calls)
+	elapsed := time.Since(start)
+	if results[0].Err != nil {
+		t.Errorf("results[0] = %+v, want a reply", results[0])
+	}
+	if err := results[3].Err; err != ErrCallTimeout {
+		t.Errorf("results[3] = %+v, want ErrCallTimeout", results[3])
+	}
+	if elapsed >= 170*time.Millisecond {
+		t.Fatalf("batch took %v, want about the %v timeout", elapsed, timeout)
+	}
+}
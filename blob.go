@@ -0,0 +1,120 @@
+package endpoint
+
+import (
+	"github.com/ugorji/go/codec"
+)
+
+// blobKey marks a param that was replaced by a BlobStore reference. On the
+// wire the param becomes a one-entry map {"$blob": ref}.
+const blobKey = "$blob"
+
+// BlobStore keeps large byte payloads out of band. Both peers must be
+// configured with stores that resolve each other's references, such as a
+// shared content-addressed store.
+type BlobStore interface {
+	Put(data []byte) (ref string, err error)
+	Get(ref string) (data []byte, err error)
+}
+
+// WithBlobStore uploads every []byte param of at least threshold bytes to
+// store and sends a reference in its place. Incoming requests have such
+// references resolved from store before they are dispatched.
+func WithBlobStore(store BlobStore, threshold int) Option {
+	return func(ep *endpoint) {
+		ep.blobs = store
+		ep.blobMin = threshold
+	}
+}
+
+// offload replaces large []byte params with blob references.
+func (ep *endpoint) offload(params []interface{}) (out []interface{}, err error) {
+	out = params
+	if ep.blobs == nil {
+		return
+	}
+	copied := false
+	for i, p := range params {
+		b, ok := p.([]byte)
+		if !ok || len(b) < ep.blobMin {
+			continue
+		}
+		var ref string
+		if ref, err = ep.blobs.Put(b); err != nil {
+			return
+		}
+		if !copied {
+			// Never modify the caller's slice.
+			out = append([]interface{}(nil), params...)
+			copied = true
+		}
+		out[i] = map[string]interface{}{blobKey: ref}
+	}
+	return
+}
+
+// resolveBlobs fetches the blobs referenced by a received params array and
+// returns the params re-encoded with the data inlined.
+func (ep *endpoint) resolveBlobs(params codec.Raw) (out codec.Raw, err error) {
+	out = params
+	if ep.blobs == nil {
+		return
+	}
+	var vals []interface{}
+	if err = codec.NewDecoderBytes(params, ep.mpk).Decode(&vals); err != nil {
+		// Not an array; there is nothing to resolve.
+		err = nil
+		return
+	}
+	found := false
+	for i, v := range vals {
+		ref, ok := blobRef(v)
+		if !ok {
+			continue
+		}
+		if vals[i], err = ep.blobs.Get(ref); err != nil {
+			return
+		}
+		found = true
+	}
+	if !found {
+		return
+	}
+	var b []byte
+	if err = codec.NewEncoderBytes(&b, ep.mpk).Encode(vals); err != nil {
+		return
+	}
+	out = b
+	return
+}
+
+func blobRef(v interface{}) (ref string, ok bool) {
+	var val interface{}
+	switch m := v.(type) {
+	case map[interface{}]interface{}:
+		if len(m) != 1 {
+			return
+		}
+		for k, e := range m {
+			if keyString(k) != blobKey {
+				return
+			}
+			val = e
+		}
+	case map[string]interface{}:
+		if len(m) != 1 {
+			return
+		}
+		if val, ok = m[blobKey]; !ok {
+			return
+		}
+	default:
+		return
+	}
+	switch r := val.(type) {
+	case string:
+		return r, true
+	case []byte:
+		return string(r), true
+	}
+	return "", false
+}
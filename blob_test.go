@@ -0,0 +1,62 @@
+package endpoint
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memBlobs is a content-addressed BlobStore in memory.
+type memBlobs struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func (s *memBlobs) Put(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	ref := hex.EncodeToString(sum[:])
+	s.mu.Lock()
+	s.blobs[ref] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return ref, nil
+}
+
+func (s *memBlobs) Get(ref string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[ref]
+	if !ok {
+		return nil, errors.New("no blob " + ref)
+	}
+	return data, nil
+}
+
+type Digest int
+
+func (*Digest) Sum(data []byte, reply *[]byte) error {
+	sum := sha256.Sum256(data)
+	*reply = sum[:]
+	return nil
+}
+
+func TestBlobStoreReference(t *testing.T) {
+	store := &memBlobs{blobs: make(map[string][]byte)}
+	c, rec := newRecordedPair(t, new(Digest), []Option{WithBlobStore(store, 1<<10)}, WithBlobStore(store, 1<<10))
+	data := make([]byte, 2<<20)
+	rand.Read(data)
+	rsp, err := c.Call("Digest.Sum", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(data)
+	if got, _ := rsp.([]byte); !bytes.Equal(got, want[:]) {
+		t.Fatal("server did not see the original 2MB param")
+	}
+	if n := len(rec.messages()[0]); n > 1<<10 {
+		t.Fatalf("request was %d bytes on the wire, want a reference", n)
+	}
+}
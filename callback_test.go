@@ -0,0 +1,37 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerCallsClient(t *testing.T) {
+	c, sc := newPair(t, nil, nil)
+	acks := make(Acker, 1)
+	if err := c.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(acks); err != nil {
+		t.Fatal(err)
+	}
+
+	rsp, err := sc.Call("Arith.Multiply", Args{6, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 42 {
+		t.Fatalf("rsp = %v, want 42", rsp)
+	}
+
+	if err := sc.Notify("Acker.Ack", Args{3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-acks:
+		if got != (Args{3, 4}) {
+			t.Fatalf("client handler got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification never reached the client's handler")
+	}
+}
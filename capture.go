@@ -0,0 +1,25 @@
+package endpoint
+
+import (
+	"io"
+)
+
+// WithMethodWireCapture copies the raw encoded bytes of every request and
+// response of method, in either direction, to w. Other traffic is not
+// captured. Messages are written to w whole, one after another, so the
+// capture is itself a valid msgpack stream.
+func WithMethodWireCapture(method string, w io.Writer) Option {
+	return func(ep *endpoint) {
+		ep.capMethod = method
+		ep.capW = w
+	}
+}
+
+func (ep *endpoint) capture(method string, msg []byte) {
+	if ep.capW == nil || method != ep.capMethod {
+		return
+	}
+	ep.capMu.Lock()
+	ep.capW.Write(msg)
+	ep.capMu.Unlock()
+}
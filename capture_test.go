@@ -0,0 +1,42 @@
+package endpoint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestMethodWireCapture(t *testing.T) {
+	var buf bytes.Buffer
+	c, _ := newPair(t, new(Arith), nil, WithMethodWireCapture("Arith.Multiply", &buf))
+	if _, err := c.Call("Arith.Divide", Args{6, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{6, 7}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call("Arith.Divide", Args{8, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the Multiply request and its response were captured.
+	dec := codec.NewDecoder(&buf, new(codec.MsgpackHandle))
+	var req, rsp []interface{}
+	if err := dec.Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req[0] != int64(msgpackRPCReq) || string(req[2].([]byte)) != "Arith.Multiply" {
+		t.Fatalf("first captured message = %v, want the Multiply request", req)
+	}
+	if err := dec.Decode(&rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp[0] != int64(msgpackRPCRsp) || rsp[3] != int64(42) {
+		t.Fatalf("second captured message = %v, want the Multiply response", rsp)
+	}
+	var extra interface{}
+	if err := dec.Decode(&extra); err == nil {
+		t.Fatalf("captured more than one exchange: %v", extra)
+	}
+}
@@ -1,44 +1,222 @@
 package endpoint
 
 import (
+	"context"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/ugorji/go/codec"
 )
 
+// Client is the dialing side of a connection. Connections are symmetric:
+// services registered on a Client can be called by the server through
+// ServerConn.Call and ServerConn.Notify, just as the client calls the server.
 type Client struct {
 	mpk    *codec.MsgpackHandle
 	ep     *endpoint
 	conn   net.Conn
 	err    error
 	closed chan int
+	once   sync.Once
 }
 
-func NewClient(conn net.Conn, handle *codec.MsgpackHandle) (c *Client) {
+// NewClient returns a Client over conn. A nil handle means a default
+// MsgpackHandle, and a given one is copied rather than changed; with a nil
+// conn every call fails with ErrNoConn.
+func NewClient(conn net.Conn, handle *codec.MsgpackHandle, opts ...Option) (c *Client) {
+	handle = ownHandle(handle)
 	c = &Client{
-		mpk:  handle,
-		conn: conn,
+		mpk:    handle,
+		conn:   conn,
+		closed: make(chan int),
 	}
-	c.ep = newEndpoint(c.conn, c.mpk)
+	c.ep = newEndpoint(transportFor(conn, handle), conn, c.mpk, opts...)
+	c.start()
+	return
+}
+
+// NewClientTransport returns a Client exchanging messages over tr rather
+// than a net.Conn.
+func NewClientTransport(tr Transport, handle *codec.MsgpackHandle, opts ...Option) (c *Client) {
+	c = &Client{
+		mpk:    ownHandle(handle),
+		closed: make(chan int),
+	}
+	c.ep = newEndpoint(tr, nil, c.mpk, opts...)
+	c.start()
+	return
+}
+
+// start runs the read loop and waits for it to begin, so that a Call made
+// as soon as the constructor returns cannot miss its response.
+func (c *Client) start() {
 	go func() {
 		c.err = c.ep.Reading(c.closed)
 	}()
+	c.ep.waitReady()
+}
+
+// DialContext connects to addr on the named network, giving up when ctx is
+// cancelled or its deadline passes, and returns a Client over the connection.
+func DialContext(ctx context.Context, network, addr string, handle *codec.MsgpackHandle, opts ...Option) (c *Client, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return
+	}
+	c = NewClient(conn, handle, opts...)
 	return
 }
 
 func (c *Client) Call(method string, params ...interface{}) (rsp interface{}, err error) {
-	return c.ep.Call(method, params)
+	return c.ep.Call(method, params...)
+}
+
+// CallContext is Call, giving up when ctx is done; see endpoint.CallContext.
+func (c *Client) CallContext(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	return c.ep.CallContext(ctx, method, params...)
+}
+
+// CallResult is Call, decoding the reply into the pointer result; see
+// endpoint.CallResult.
+func (c *Client) CallResult(method string, result interface{}, params ...interface{}) (err error) {
+	return c.ep.CallResult(method, result, params...)
+}
+
+// CallWithServerTime is Call, also returning the server's clock as stamped
+// on the response.
+func (c *Client) CallWithServerTime(method string, params ...interface{}) (rsp interface{}, serverTime time.Time, err error) {
+	return c.ep.CallWithServerTime(method, params...)
+}
+
+// CallWithProgress is Call, invoking progress for every update the handler
+// reports before its reply.
+func (c *Client) CallWithProgress(method string, progress func(percent int), params ...interface{}) (rsp interface{}, err error) {
+	return c.ep.CallWithProgress(method, progress, params...)
+}
+
+// CallIdempotent is Call carrying an idempotency key, so a retry is not
+// executed twice by servers sharing a DedupCache.
+func (c *Client) CallIdempotent(key string, method string, params ...interface{}) (rsp interface{}, err error) {
+	return c.ep.CallIdempotent(key, method, params...)
+}
+
+// EncodedSize reports the size in bytes of the request a Call with these
+// arguments would send.
+func (c *Client) EncodedSize(method string, params ...interface{}) (n int, err error) {
+	return c.ep.EncodedSize(method, params...)
+}
+
+// CallArrayStream is Call returning an array reply as an iterator; see
+// endpoint.CallArrayStream.
+func (c *Client) CallArrayStream(method string, params ...interface{}) (it *ArrayIter, err error) {
+	return c.ep.CallArrayStream(method, params...)
+}
+
+// CallBatch sends several calls with one write; see endpoint.CallBatch.
+func (c *Client) CallBatch(calls []BatchCall) []BatchResult {
+	return c.ep.CallBatch(calls)
+}
+
+// LongPoll is a call the server may hold until an event happens; see
+// endpoint.LongPoll.
+func (c *Client) LongPoll(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	return c.ep.LongPoll(ctx, method, params...)
+}
+
+// Speculate issues a call without waiting for it; see endpoint.Speculate.
+func (c *Client) Speculate(method string, params ...interface{}) (commit func() (interface{}, error), cancel func()) {
+	return c.ep.Speculate(method, params...)
 }
 
 func (c *Client) Notify(method string, params ...interface{}) (err error) {
-	return c.ep.Notify(method, params)
+	return c.ep.Notify(method, params...)
+}
+
+// ReliableNotify sends a notification that is delivered at least once;
+// see endpoint.ReliableNotify.
+func (c *Client) ReliableNotify(method string, params ...interface{}) (err error) {
+	return c.ep.ReliableNotify(method, params...)
+}
+
+// NotifyStruct sends arg itself as the params of a notification; see
+// endpoint.NotifyStruct.
+func (c *Client) NotifyStruct(method string, arg interface{}) (err error) {
+	return c.ep.NotifyStruct(method, arg)
+}
+
+// NotifyThenCall sends a notification and a call with nothing in between;
+// see endpoint.NotifyThenCall.
+func (c *Client) NotifyThenCall(notify string, notifyParams []interface{}, method string, params ...interface{}) (rsp interface{}, err error) {
+	return c.ep.NotifyThenCall(notify, notifyParams, method, params...)
+}
+
+// Stats returns how many times each method registered on this side of
+// the connection has been called, keyed by "Service.Method".
+func (c *Client) Stats() MethodStats {
+	return c.ep.Stats()
+}
+
+// SnapshotAndReset returns the call counts and zeroes them.
+func (c *Client) SnapshotAndReset() MethodStats {
+	return c.ep.SnapshotAndReset()
+}
+
+// ResetStats zeroes the call counts.
+func (c *Client) ResetStats() {
+	c.ep.ResetStats()
 }
 
 func (c *Client) Register(svc interface{}) (err error) {
 	return c.ep.Register(svc)
 }
 
+func (c *Client) RegisterName(svc interface{}, name string) (err error) {
+	return c.ep.RegisterName(svc, name)
+}
+
+func (c *Client) RegisterMethod(method interface{}) (err error) {
+	return c.ep.RegisterMethod(method)
+}
+
+func (c *Client) RegisterMethodName(method interface{}, name string) (err error) {
+	return c.ep.RegisterMethodName(method, name)
+}
+
+// Close shuts the client down. Calls still waiting for a response fail with
+// ErrShutdown, as does any call made afterwards. It is safe to call Close
+// more than once and concurrently with Call.
 func (c *Client) Close() {
-	close(c.closed)
-	c.conn.Close()
+	c.once.Do(func() {
+		close(c.closed)
+		c.ep.Close()
+	})
+}
+
+// CloseGracefully stops new calls, which fail with ErrShutdown, waits for
+// the calls already made to be answered and then closes the connection.
+// If ctx is done first the connection is closed anyway, failing the
+// remaining calls, and ctx.Err() is returned.
+func (c *Client) CloseGracefully(ctx context.Context) (err error) {
+	err = c.ep.drainPending(ctx)
+	c.Close()
+	return
+}
+
+// LocalAddr returns the local address of the connection, or nil without one.
+func (c *Client) LocalAddr() net.Addr {
+	return c.ep.LocalAddr()
+}
+
+// Err returns why the connection ended: ErrShutdown after Close, otherwise
+// the error that stopped the read loop. It is nil while the connection is
+// up.
+func (c *Client) Err() error {
+	return c.ep.Err()
+}
+
+// Done returns a channel that is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.ep.Done()
 }
@@ -0,0 +1,207 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			sc := NewServerConn(conn, nil)
+			sc.Register(new(Arith))
+			go sc.Serve()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c, err := DialContext(ctx, "tcp", l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel2 := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel2()
+	<-short.Done()
+	c2, err := DialContext(short, "tcp", l.Addr().String(), nil)
+	var nerr net.Error
+	if c2 != nil || !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("DialContext with an expired context = %v, %v; want a timeout", c2, err)
+	}
+}
+
+type Summer int
+
+func (*Summer) Sum(xs []int, reply *int) error {
+	for _, x := range xs {
+		*reply += x
+	}
+	return nil
+}
+
+// decodedParams decodes a request or notification and returns its params.
+func decodedParams(t *testing.T, msg []byte) []interface{} {
+	t.Helper()
+	var frame []interface{}
+	if err := codec.NewDecoderBytes(msg, new(codec.MsgpackHandle)).Decode(&frame); err != nil {
+		t.Fatal(err)
+	}
+	i := 2 // [type, method, params]
+	if frame[0] == int64(msgpackRPCReq) {
+		i = 3 // [type, msgid, method, params, ...]
+	}
+	params, _ := frame[i].([]interface{})
+	return params
+}
+
+func TestVariadicParamsSpread(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Summer), nil)
+	rsp, err := c.Call("Summer.Sum", 1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 6 {
+		t.Fatalf("rsp = %v, want 6", rsp)
+	}
+	if err := c.Notify("Summer.Sum", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range rec.messages() {
+		if params := decodedParams(t, msg); len(params) != 3 {
+			t.Fatalf("params on the wire = %v, want three elements", params)
+		}
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	sc := NewServerConn(b, nil)
+	defer sc.Close()
+	go sc.Serve()
+	go sc.Call("Summer.Sum", 1, 2, 3)
+	tr := NewConnTransport(a, nil)
+	msg, err := tr.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := decodedParams(t, msg); len(params) != 3 {
+		t.Fatalf("ServerConn.Call params on the wire = %v, want three elements", params)
+	}
+}
+
+func TestCloseGracefully(t *testing.T) {
+	c, _ := newPair(t, new(Sleeper), nil)
+	slow := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Sleeper.Sleep", int64(100*time.Millisecond))
+		slow <- err
+	}()
+	waitFor(t, "the slow call to be sent", func() bool { return c.ep.pendingCount() == 1 })
+	closed := make(chan error, 1)
+	go func() { closed <- c.CloseGracefully(context.Background()) }()
+	waitFor(t, "new calls to be refused", func() bool {
+		_, err := c.Call("Sleeper.Sleep", int64(0))
+		return errors.Is(err, ErrShutdown)
+	})
+	if err := <-slow; err != nil {
+		t.Fatalf("in-flight call failed: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Err(); !errors.Is(err, ErrShutdown) {
+		t.Fatalf("Err() = %v after CloseGracefully, want ErrShutdown", err)
+	}
+}
+
+func TestCloseGracefullyDeadline(t *testing.T) {
+	c, _ := newPair(t, &Events{ch: make(chan int)}, nil)
+	stuck := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Events.Next", 0)
+		stuck <- err
+	}()
+	waitFor(t, "the call to be sent", func() bool { return c.ep.pendingCount() == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.CloseGracefully(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CloseGracefully = %v, want context.DeadlineExceeded", err)
+	}
+	if err := <-stuck; err == nil {
+		t.Fatal("call still pending at the deadline succeeded")
+	}
+}
+
+func TestNilConn(t *testing.T) {
+	c := NewClient(nil, nil)
+	defer c.Close()
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); !errors.Is(err, ErrNoConn) {
+		t.Fatalf("Call = %v, want ErrNoConn", err)
+	}
+	if err := c.Notify("Arith.Multiply", Args{2, 3}); !errors.Is(err, ErrNoConn) {
+		t.Fatalf("Notify = %v, want ErrNoConn", err)
+	}
+
+	sc := NewServerConn(nil, nil)
+	defer sc.Close()
+	if err := sc.Serve(); !errors.Is(err, ErrNoConn) {
+		t.Fatalf("Serve = %v, want ErrNoConn", err)
+	}
+	if _, err := sc.Call("Arith.Multiply", Args{2, 3}); !errors.Is(err, ErrNoConn) {
+		t.Fatalf("ServerConn.Call = %v, want ErrNoConn", err)
+	}
+}
+
+type Users int
+
+func (*Users) Get(id int, reply *map[string]interface{}) error {
+	if id == 0 {
+		return errors.New("no such user")
+	}
+	*reply = map[string]interface{}{"user_id": id, "name": "ada"}
+	return nil
+}
+
+type Profile struct {
+	ID   int    `codec:"user_id"`
+	Name string `codec:"name"`
+}
+
+func TestCallResult(t *testing.T) {
+	c, _ := newPair(t, new(Users), nil)
+	var p Profile
+	if err := c.CallResult("Users.Get", &p, 7); err != nil {
+		t.Fatal(err)
+	}
+	if p != (Profile{7, "ada"}) {
+		t.Fatalf("result = %+v", p)
+	}
+	if err := c.CallResult("Users.Get", nil, 7); err != nil {
+		t.Fatalf("discarding the reply: %v", err)
+	}
+	p = Profile{Name: "untouched"}
+	if err := c.CallResult("Users.Get", &p, 0); err == nil || err.Error() != "no such user" {
+		t.Fatalf("err = %v, want the remote error", err)
+	}
+	if p != (Profile{Name: "untouched"}) {
+		t.Fatalf("result = %+v after a failed call, want it untouched", p)
+	}
+}
@@ -0,0 +1,76 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type coalescer struct {
+	mu     sync.Mutex
+	window time.Duration
+	groups map[string]*coalesceGroup
+}
+
+type coalesceGroup struct {
+	done chan struct{}
+	rsp  interface{}
+	err  error
+}
+
+// WithCoalesceWindow merges identical calls, same method and same encoded
+// params, into one request. The first call waits d for others to join
+// before sending; calls arriving while it is in flight join it too. All
+// callers get the same reply value and must not modify it.
+func WithCoalesceWindow(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.coalesce.window = d
+	}
+}
+
+// coalescedCall performs a Call through the coalescer. The shared request
+// runs on its own goroutine, so a caller whose ctx is done can leave
+// without affecting the others.
+func (ep *endpoint) coalescedCall(ctx context.Context, method string, params []interface{}) (rsp interface{}, err error) {
+	var b []byte
+	if err = codec.NewEncoderBytes(&b, ep.mpk).Encode(params); err != nil {
+		return
+	}
+	key := method + "\x00" + string(b)
+	c := &ep.coalesce
+	c.mu.Lock()
+	g, ok := c.groups[key]
+	if !ok {
+		if c.groups == nil {
+			c.groups = make(map[string]*coalesceGroup)
+		}
+		g = &coalesceGroup{done: make(chan struct{})}
+		c.groups[key] = g
+		go ep.runGroup(key, g, method, params)
+	}
+	c.mu.Unlock()
+	select {
+	case <-g.done:
+		return g.rsp, g.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runGroup waits out the window, then sends the group's request and
+// publishes its reply.
+func (ep *endpoint) runGroup(key string, g *coalesceGroup, method string, params []interface{}) {
+	c := &ep.coalesce
+	time.Sleep(c.window)
+	req := new(request)
+	if g.err = ep.start(req, method, params); g.err == nil {
+		g.rsp, g.err = ep.wait(req)
+	}
+
+	c.mu.Lock()
+	delete(c.groups, key)
+	c.mu.Unlock()
+	close(g.done)
+}
@@ -0,0 +1,32 @@
+package endpoint
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCoalesceWindow(t *testing.T) {
+	c, sc := newPair(t, new(Arith), nil, WithCoalesceWindow(50*time.Millisecond))
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rsp, err := c.Call("Arith.Multiply", Args{2, 3})
+			if n, _ := rsp.(int64); err != nil || n != 6 {
+				t.Errorf("call = %v, %v", rsp, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := sc.Stats()["Arith.Multiply"]; n != 1 {
+		t.Fatalf("server ran Arith.Multiply %d times, want 1", n)
+	}
+
+	// Different params are not merged.
+	c.Call("Arith.Multiply", Args{2, 4})
+	if n := sc.Stats()["Arith.Multiply"]; n != 2 {
+		t.Fatalf("server ran Arith.Multiply %d times, want 2", n)
+	}
+}
@@ -0,0 +1,32 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCallContextDeadline(t *testing.T) {
+	c, _ := newPair(t, &Events{ch: make(chan int)}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallContext(ctx, "Events.Next", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := c.ep.pendingCount(); n != 0 {
+		t.Fatalf("%d calls still pending after the deadline", n)
+	}
+}
+
+func TestCallContextCancel(t *testing.T) {
+	c, _ := newPair(t, &Events{ch: make(chan int)}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := c.CallContext(ctx, "Events.Next", 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if n := c.ep.pendingCount(); n != 0 {
+		t.Fatalf("%d calls still pending after cancel", n)
+	}
+}
@@ -0,0 +1,45 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// mdCorrelationID carries the correlation id of a call.
+const mdCorrelationID = "correlation_id"
+
+// WithCallCorrelation gives every call that goes through the call
+// interceptors a random UUID as its correlation id. Unlike the msgid it
+// stays the same when WithCallRetry sends the call again, so logs can
+// follow the call from end to end. It is sent in the request metadata,
+// logged with retries and reported by InFlightRequests; interceptors on
+// both sides read it with CorrelationIDFromContext.
+func WithCallCorrelation() Option {
+	return func(ep *endpoint) {
+		ep.correlate = true
+	}
+}
+
+// CorrelationIDFromContext returns the correlation id of the call that a
+// CallInterceptor or a handler runs under ctx.
+func CorrelationIDFromContext(ctx context.Context) (id string, ok bool) {
+	return MetadataFromContext(ctx).String(mdCorrelationID)
+}
+
+// newCorrelationID returns a random (version 4) UUID.
+func newCorrelationID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// correlationNote formats cid for a log line, if there is one.
+func correlationNote(cid string) string {
+	if cid == "" {
+		return ""
+	}
+	return " [" + cid + "]"
+}
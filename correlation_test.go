@@ -0,0 +1,95 @@
+package endpoint
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCorrelationAcrossReconnect(t *testing.T) {
+	srvLog := new(captureLogger)
+	var mu sync.Mutex
+	var conns []net.Conn
+	// The first connection is dropped as soon as the call reaches it.
+	logCID := func(ctx context.Context, method string, arg interface{}, next func() error) error {
+		cid, _ := CorrelationIDFromContext(ctx)
+		srvLog.Printf("handling %s [%s]", method, cid)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(conns) == 1 {
+			conns[0].Close()
+			return nil
+		}
+		return next()
+	}
+	serve := func() net.Conn {
+		a, b := net.Pipe()
+		mu.Lock()
+		conns = append(conns, a)
+		mu.Unlock()
+		sc := NewServerConn(b, nil, WithHandlerInterceptor(logCID))
+		sc.Register(new(Arith))
+		go sc.Serve()
+		t.Cleanup(sc.Close)
+		return a
+	}
+	dial := func() (net.Conn, error) { return serve(), nil }
+
+	cliLog := new(captureLogger)
+	var calls []string
+	record := func(ctx context.Context, method string, params []interface{}, next func() (interface{}, error)) (interface{}, error) {
+		cid, _ := CorrelationIDFromContext(ctx)
+		calls = append(calls, cid)
+		return next()
+	}
+	c := NewClient(serve(), nil, WithDialFunc(dial), WithReconnect(time.Millisecond),
+		WithCallCorrelation(), WithCallRetry(1), WithCallInterceptor(record), WithLogger(cliLog))
+	defer c.Close()
+
+	rsp, err := c.Call("Arith.Multiply", Args{4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 20 {
+		t.Fatalf("rsp = %v, want 20", rsp)
+	}
+	if len(calls) != 1 || len(calls[0]) != 36 {
+		t.Fatalf("interceptor saw correlation ids %q, want one UUID", calls)
+	}
+	cid := calls[0]
+	want := "handling Arith.Multiply [" + cid + "]"
+	if logged := srvLog.logged(); len(logged) != 2 || logged[0] != want || logged[1] != want {
+		t.Fatalf("server logged %q, want %q before and after the reconnect", logged, want)
+	}
+	if logged := strings.Join(cliLog.logged(), "\n"); !strings.Contains(logged, "retrying") || !strings.Contains(logged, cid) {
+		t.Fatalf("client logged %q, want the retry with %s", logged, cid)
+	}
+}
+
+func TestCorrelationInFlight(t *testing.T) {
+	gate := make(Gate)
+	sent := make(chan string, 1)
+	record := func(ctx context.Context, method string, params []interface{}, next func() (interface{}, error)) (interface{}, error) {
+		cid, _ := CorrelationIDFromContext(ctx)
+		sent <- cid
+		return next()
+	}
+	c, sc := newPair(t, gate, nil, WithCallCorrelation(), WithCallInterceptor(record))
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Gate.Wait", Args{7, 8})
+		done <- err
+	}()
+	cid := <-sent
+	waitFor(t, "the handler to start", func() bool { return len(sc.InFlightRequests()) == 1 })
+	if got := sc.InFlightRequests()[0].CorrelationID; got == "" || got != cid {
+		t.Fatalf("in-flight correlation id = %q, want %q", got, cid)
+	}
+	close(gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
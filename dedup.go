@@ -0,0 +1,87 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const mdIdempotencyKey = "idempotency_key"
+
+// DedupCache remembers the outcome of requests sent with an idempotency
+// key, so that a retried request, even one arriving on another connection
+// sharing the cache, is answered without running the handler again. Only
+// successes are kept: a request that failed runs again when retried.
+type DedupCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*dedupEntry
+	queue   []*dedupEntry // completed entries, oldest first
+}
+
+type dedupEntry struct {
+	key     string
+	done    chan struct{}
+	rerr    interface{}
+	result  interface{}
+	expires time.Time
+}
+
+// NewDedupCache returns a cache that keeps completed outcomes for ttl.
+func NewDedupCache(ttl time.Duration) *DedupCache {
+	return &DedupCache{
+		ttl:     ttl,
+		entries: make(map[string]*dedupEntry),
+	}
+}
+
+// WithDedupCache answers keyed requests from c. Share c between the
+// ServerConns that should see each other's requests.
+func WithDedupCache(c *DedupCache) Option {
+	return func(ep *endpoint) {
+		ep.dedup = c
+	}
+}
+
+// begin returns the entry for key and whether the caller is the first to
+// ask for it, in which case it must run the request and call finish.
+func (c *DedupCache) begin(key string) (e *dedupEntry, first bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queue) > 0 && now.After(c.queue[0].expires) {
+		delete(c.entries, c.queue[0].key)
+		c.queue = c.queue[1:]
+	}
+	if e = c.entries[key]; e != nil {
+		return e, false
+	}
+	e = &dedupEntry{key: key, done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true
+}
+
+// finish records the outcome of e. A success is kept for the ttl, queued
+// behind the ones finished before it, which expire first; an error is
+// only passed to the requests already waiting for it.
+func (c *DedupCache) finish(e *dedupEntry, rerr, result interface{}) {
+	c.mu.Lock()
+	e.rerr = rerr
+	e.result = result
+	if rerr != nil {
+		delete(c.entries, e.key)
+	} else {
+		e.expires = time.Now().Add(c.ttl)
+		c.queue = append(c.queue, e)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// CallIdempotent is Call with an idempotency key. Servers using a
+// DedupCache run the handler at most once per key and method, answering
+// repeats with the first outcome.
+func (ep *endpoint) CallIdempotent(key string, method string, params ...interface{}) (rsp interface{}, err error) {
+	req := &request{meta: Metadata{mdIdempotencyKey: key}}
+	return ep.roundTrip(context.Background(), req, method, params, ep.await)
+}
@@ -0,0 +1,103 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Counter counts its executions and answers with the count so far.
+type Counter struct{ n int32 }
+
+func (c *Counter) Incr(_ int, reply *int) error {
+	*reply = int(atomic.AddInt32(&c.n, 1))
+	return nil
+}
+
+func TestDedupAcrossPool(t *testing.T) {
+	cache := NewDedupCache(time.Minute)
+	counter := new(Counter)
+	var servers []*ServerConn
+	p, err := NewPool(2, func() (net.Conn, error) {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil, WithDedupCache(cache))
+		sc.Register(counter)
+		go sc.Serve()
+		servers = append(servers, sc)
+		return a, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		p.Close()
+		for _, sc := range servers {
+			sc.Close()
+		}
+	}()
+
+	// The retry goes out on the other connection, to the other server.
+	for i, c := range p.clients {
+		rsp, err := c.CallIdempotent("order-42", "Counter.Incr", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := rsp.(int64); n != 1 {
+			t.Fatalf("call on connection %d: rsp = %v, want the first outcome 1", i, rsp)
+		}
+	}
+	if n := atomic.LoadInt32(&counter.n); n != 1 {
+		t.Fatalf("handler ran %d times, want once", n)
+	}
+}
+
+// Flaky fails its first execution and then answers with the count so far.
+type Flaky struct{ n int32 }
+
+func (f *Flaky) Try(_ int, reply *int) error {
+	n := atomic.AddInt32(&f.n, 1)
+	if n == 1 {
+		return errors.New("try again")
+	}
+	*reply = int(n)
+	return nil
+}
+
+func TestDedupDoesNotKeepErrors(t *testing.T) {
+	c, _ := newPair(t, new(Flaky), []Option{WithDedupCache(NewDedupCache(time.Minute))})
+	if _, err := c.CallIdempotent("k", "Flaky.Try", 0); err == nil || err.Error() != "try again" {
+		t.Fatalf("first call: err = %v, want the handler's", err)
+	}
+	for i := 0; i < 2; i++ {
+		rsp, err := c.CallIdempotent("k", "Flaky.Try", 0)
+		if n, _ := rsp.(int64); err != nil || n != 2 {
+			t.Fatalf("retry %d = %v, %v; want the second execution's 2", i, rsp, err)
+		}
+	}
+}
+
+func TestDedupExpiry(t *testing.T) {
+	cache := NewDedupCache(10 * time.Millisecond)
+	counter := new(Counter)
+	c, _ := newPair(t, counter, []Option{WithDedupCache(cache)})
+	for _, key := range []string{"a", "a"} {
+		if _, err := c.CallIdempotent(key, "Counter.Incr", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := c.CallIdempotent("b", "Counter.Incr", 0); err != nil {
+		t.Fatal(err)
+	}
+	cache.mu.Lock()
+	n, queued := len(cache.entries), len(cache.queue)
+	cache.mu.Unlock()
+	if n != 1 || queued != 1 {
+		t.Fatalf("%d entries, %d queued after expiry; want only b", n, queued)
+	}
+	if rsp, _ := c.CallIdempotent("a", "Counter.Incr", 0); rsp != int64(3) {
+		t.Fatalf("expired key answered with %v, want a new execution 3", rsp)
+	}
+}
@@ -0,0 +1,318 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+)
+
+// decodeArg decodes a request's params into a new value of argType. The
+// usual params array holds a single element, the arg itself. A toarray
+// struct or a slice or array arg may instead be filled from the whole
+// params array, positionally; params that are not an array at all, as
+// sent by NotifyStruct, are the arg itself. Struct args must not receive
+// fields they lack. Anything else is rejected with an error wrapping
+// ErrBadRequest and the handler is not called.
+func (ep *endpoint) decodeArg(params codec.Raw, argType reflect.Type) (arg reflect.Value, err error) {
+	elemType := argType
+	isPtr := argType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = argType.Elem()
+	}
+	h := ep.argHandle(elemType)
+	n, rest, herr := readArrayLen(params)
+	whole := herr != nil
+	if herr == nil && n == 1 {
+		v := ep.newArg(elemType)
+		if err = codec.NewDecoderBytes(rest, h).Decode(v.Interface()); err == nil {
+			return argValue(v, isPtr), nil
+		}
+	}
+	if herr == nil && isPositional(elemType) {
+		whole = true
+	}
+	if whole {
+		v := ep.newArg(elemType)
+		if err = codec.NewDecoderBytes(params, h).Decode(v.Interface()); err == nil {
+			return argValue(v, isPtr), nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("got %d params", n)
+	}
+	err = fmt.Errorf("%w: cannot decode params into %s: %v", ErrBadRequest, argType, err)
+	return
+}
+
+// isPositional reports whether an arg of type t may be filled from the
+// whole params array.
+func isPositional(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	case reflect.Array:
+		return true
+	case reflect.Struct:
+		return isToArrayType(t)
+	}
+	return false
+}
+
+// argHandle returns the handle to decode an arg of type t with: for
+// structs, ep.strict, which fails on fields the struct lacks.
+func (ep *endpoint) argHandle(t reflect.Type) *codec.MsgpackHandle {
+	if t.Kind() != reflect.Struct {
+		return ep.mpk
+	}
+	return ep.strict
+}
+
+func argValue(v reflect.Value, isPtr bool) reflect.Value {
+	if isPtr {
+		return v
+	}
+	return v.Elem()
+}
+
+// handleRequest dispatches [0, msgid, method, params] and an optional
+// metadata map to the registered method. The handler runs off the read
+// loop; any failure to find or call it is answered with an error response.
+func (ep *endpoint) handleRequest(msg []byte, parts []codec.Raw) (err error) {
+	var msgid uint32
+	var method string
+	if err = ep.decodeRaw(parts[1], &msgid); err != nil {
+		return fmt.Errorf("rpc: decode: request msgid: %w", err)
+	}
+	if err = ep.decodeRaw(parts[2], &method); err != nil {
+		return fmt.Errorf("rpc: decode: request method: %w", err)
+	}
+	params := parts[3]
+	ep.capture(method, msg)
+	ep.audit(AuditRequest, msgid, method, params, nil, nil)
+	var meta codec.Raw
+	var md Metadata
+	if len(parts) > 4 {
+		meta = parts[4]
+		if ep.decodeRaw(meta, &md) != nil {
+			md = nil
+		}
+	}
+	if ep.replay != nil {
+		if rerr := ep.checkReplay(method, params, meta); rerr != nil {
+			ep.reply(method, msgid, rerr.Error(), nil)
+			return
+		}
+	}
+	if succ := ep.successor.Load(); succ != nil {
+		ep.schedule(func() { ep.forward(succ, false, msgid, method, params, meta) })
+		return
+	}
+	ep.trackRequest(msgid, method, params, md)
+	if !ep.schedule(func() {
+		defer ep.untrackRequest(msgid)
+		ep.serve(msgid, method, params, md)
+	}) {
+		ep.untrackRequest(msgid)
+	}
+	return
+}
+
+// handleNotify acts on [2, method, params], checked first against a
+// ReplayGuard if there is one. Reserved notifications used by
+// the endpoint itself are handled on the read loop; others run the
+// registered notify handler, and no response is ever sent. Unknown
+// notifications are logged and dropped.
+func (ep *endpoint) handleNotify(msg []byte, parts []codec.Raw) (err error) {
+	var method string
+	if err = ep.decodeRaw(parts[1], &method); err != nil {
+		return fmt.Errorf("rpc: decode: notify method: %w", err)
+	}
+	params := parts[2]
+	ep.capture(method, msg)
+	var meta codec.Raw
+	if len(parts) > 3 {
+		meta = parts[3]
+	}
+	if ep.replay != nil {
+		if rerr := ep.checkReplay(method, params, meta); rerr != nil {
+			ep.logger.Printf("rpc: notification %s rejected: %v", method, rerr)
+			return
+		}
+	}
+	switch method {
+	case progressMethod:
+		var args []int64
+		if ep.decodeRaw(params, &args) == nil && len(args) == 2 {
+			ep.onProgress(uint32(args[0]), int(args[1]))
+		}
+		return
+	case drainingMethod:
+		if ep.onDraining != nil {
+			ep.onDraining()
+		}
+		return
+	case goodbyeMethod:
+		ep.peerGone.Store(true)
+		return
+	case reliableMethod:
+		ep.onReliable(params)
+		return
+	case ackMethod:
+		var args []uint64
+		if ep.decodeRaw(params, &args) == nil && len(args) == 1 {
+			ep.ack(args[0])
+		}
+		return
+	}
+	ep.dispatchNotify(method, params, meta)
+	return
+}
+
+// dispatchNotify runs the notify handler for method, or forwards the
+// notification to the successor set by MigrateTo.
+func (ep *endpoint) dispatchNotify(method string, params, meta codec.Raw) {
+	ep.audit(AuditNotify, 0, method, params, nil, nil)
+	if succ := ep.successor.Load(); succ != nil {
+		ep.schedule(func() { ep.forward(succ, true, 0, method, params, meta) })
+		return
+	}
+	ep.schedule(func() {
+		if rerr, _ := ep.call(0, method, params, nil, true); rerr != nil {
+			ep.logger.Printf("rpc: notification %s failed: %v", method, rerr)
+		}
+	})
+}
+
+// serve runs a request and sends its response. With a DedupCache, a
+// request carrying an idempotency key that was seen before is answered
+// with the earlier outcome instead.
+func (ep *endpoint) serve(msgid uint32, method string, params codec.Raw, md Metadata) {
+	key, ok := md.String(mdIdempotencyKey)
+	if !ok || ep.dedup == nil {
+		rerr, result := ep.call(msgid, method, params, md, false)
+		ep.reply(method, msgid, rerr, result)
+		return
+	}
+	e, first := ep.dedup.begin(method + "\x00" + key)
+	if first {
+		rerr, result := ep.call(msgid, method, params, md, false)
+		ep.dedup.finish(e, rerr, result)
+	} else {
+		<-e.done
+	}
+	ep.reply(method, msgid, e.rerr, e.result)
+}
+
+// call runs the handler for method and returns the error and result
+// elements of its response. For a notification, msgid is zero and the
+// handler is looked up among the notify handlers.
+func (ep *endpoint) call(msgid uint32, method string, params codec.Raw, md Metadata, notify bool) (rerr, result interface{}) {
+	s, mtype, err := ep.lookup(method, notify)
+	if err == nil {
+		err = ep.fault(PhaseDispatch)
+	}
+	if err == nil {
+		params, err = ep.resolveBlobs(params)
+	}
+	var arg reflect.Value
+	if err == nil {
+		arg, err = ep.decodeArg(params, mtype.ArgType)
+	}
+	if err == nil {
+		defer ep.freeArg(mtype.ArgType, arg)
+		err = validate(arg)
+	}
+	if err != nil {
+		return ep.errorValue(err), nil
+	}
+	mtype.incCalls()
+
+	ctx, cancel := ep.handlerContext(context.Background(), method)
+	defer cancel()
+	ctx, pollCancel, poll := pollContext(ctx, md)
+	defer pollCancel()
+	if key, ok := md.String(mdIdempotencyKey); ok && ep.hedges != nil {
+		key = method + "\x00" + key
+		g := ep.hedges.join(key, cancel)
+		defer ep.hedges.finish(key, g)
+	}
+	ctx = withMetadata(ctx, md)
+	ctx = ep.withPeerCert(ctx)
+	ctx = ep.withRemoteAddr(ctx)
+	if !notify {
+		ctx = withProgress(ctx, ep, msgid)
+	}
+	args := make([]reflect.Value, 0, 4)
+	if !mtype.fn {
+		args = append(args, s.rcvr)
+	}
+	if mtype.ctx {
+		args = append(args, reflect.ValueOf(ctx))
+	}
+	args = append(args, arg)
+	var reply reflect.Value
+	if mtype.ReplyType != nil {
+		reply = reflect.New(mtype.ReplyType.Elem())
+		args = append(args, reply)
+	}
+	err = ep.runHandler(ctx, method, mtype.method.Func, args, arg)
+	if poll {
+		// A long poll that found an event keeps it even if it was late.
+		err = pollResult(err)
+	} else if err == nil && ctx.Err() == context.DeadlineExceeded {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return ep.errorValue(err), nil
+	}
+	if reply.IsValid() {
+		result = reply.Interface()
+	}
+	return
+}
+
+// lookup finds the service and method named by "Service.Method", among
+// the notify handlers if notify is set.
+func (ep *endpoint) lookup(method string, notify bool) (s *service, mtype *methodType, err error) {
+	dot := strings.LastIndex(method, ".")
+	if dot < 0 {
+		err = errors.New("rpc: service/method request ill-formed: " + method)
+		return
+	}
+	ep.mu.Lock()
+	s = ep.serviceMap[method[:dot]]
+	if s != nil && notify {
+		mtype = s.notify[method[dot+1:]]
+	} else if s != nil {
+		mtype = s.method[method[dot+1:]]
+	}
+	ep.mu.Unlock()
+	if s == nil {
+		err = errors.New("rpc: can't find service " + method)
+	} else if mtype == nil {
+		err = errors.New("rpc: can't find method " + method)
+	}
+	return
+}
+
+// validator is implemented by args that check themselves. The handler is
+// only called if Validate returns nil; otherwise its error is the reply.
+type validator interface {
+	Validate() error
+}
+
+func validate(arg reflect.Value) error {
+	if v, ok := arg.Interface().(validator); ok {
+		return v.Validate()
+	}
+	if arg.CanAddr() {
+		if v, ok := arg.Addr().Interface().(validator); ok {
+			return v.Validate()
+		}
+	}
+	return nil
+}
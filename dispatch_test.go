@@ -0,0 +1,324 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type Pos struct {
+	_struct struct{} `codec:",toarray"`
+	A       int
+	B       string
+}
+
+type Text int
+
+func (*Text) Upper(s string, reply *string) error {
+	*reply = strings.ToUpper(s)
+	return nil
+}
+
+func encodeParams(t *testing.T, h *codec.MsgpackHandle, params ...interface{}) codec.Raw {
+	t.Helper()
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, h).Encode(params); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeArgRejectsMismatchedParams(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil)
+	for _, tc := range []struct {
+		name   string
+		typ    reflect.Type
+		params []interface{}
+	}{
+		{"int into string", reflect.TypeOf(""), []interface{}{5}},
+		{"ints into string", reflect.TypeOf(""), []interface{}{1, 2, 3}},
+		{"ints into bytes", reflect.TypeOf([]byte(nil)), []interface{}{1, 2, 3}},
+		{"ints into int", reflect.TypeOf(0), []interface{}{1, 2}},
+		{"unknown field", reflect.TypeOf(Args{}), []interface{}{map[string]int{"Z": 1}}},
+		{"positional into map struct", reflect.TypeOf(Args{}), []interface{}{1, 2}},
+	} {
+		_, err := ep.decodeArg(encodeParams(t, ep.mpk, tc.params...), tc.typ)
+		if !errors.Is(err, ErrBadRequest) {
+			t.Errorf("%s: err = %v, want ErrBadRequest", tc.name, err)
+		}
+	}
+}
+
+func TestDecodeArgPositional(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil)
+	arg, err := ep.decodeArg(encodeParams(t, ep.mpk, 7, "x"), reflect.TypeOf(Pos{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := arg.Interface().(Pos); p.A != 7 || p.B != "x" {
+		t.Fatalf("arg = %+v", p)
+	}
+	arg, err = ep.decodeArg(encodeParams(t, ep.mpk, 1, 2, 3), reflect.TypeOf([]int(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := arg.Interface().([]int); !reflect.DeepEqual(s, []int{1, 2, 3}) {
+		t.Fatalf("arg = %v", s)
+	}
+	arg, err = ep.decodeArg(encodeParams(t, ep.mpk, Args{2, 3}), reflect.TypeOf(&Args{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := arg.Interface().(*Args); *a != (Args{2, 3}) {
+		t.Fatalf("arg = %+v", a)
+	}
+}
+
+func TestBadRequestNotDispatched(t *testing.T) {
+	c, _ := newPair(t, new(Text), nil)
+	if _, err := c.Call("Text.Upper", 5); err == nil || !strings.HasPrefix(err.Error(), ErrBadRequest.Error()) {
+		t.Fatalf("err = %v, want a bad request", err)
+	}
+	rsp, err := c.Call("Text.Upper", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rsp.([]byte); string(s) != "ABC" {
+		t.Fatalf("rsp = %v", rsp)
+	}
+}
+
+func TestMaxMethodNameLen(t *testing.T) {
+	c, _ := newPair(t, new(Arith), []Option{WithMaxMethodNameLen(32)})
+	long := "Arith." + strings.Repeat("x", 1<<20)
+	if _, err := c.Call(long, Args{1, 2}); err == nil || err.Error() != ErrMethodNameTooLong.Error() {
+		t.Fatalf("err = %v, want %v", err, ErrMethodNameTooLong)
+	}
+	// The connection survives the rejection.
+	if _, err := c.Call("Arith.Multiply", Args{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Repeat is tagged with the msgpack key rather than codec.
+type Repeat struct {
+	_struct struct{} `msgpack:",toarray"`
+	S       string
+	N       int
+}
+
+func (*Text) Repeat(r Repeat, reply *string) error {
+	*reply = strings.Repeat(r.S, r.N)
+	return nil
+}
+
+func TestToArrayParams(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Text), nil)
+	rsp, err := c.Call("Text.Repeat", Repeat{S: "ab", N: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rsp.([]byte); string(s) != "ababab" {
+		t.Fatalf("rsp = %v", rsp)
+	}
+	var req []interface{}
+	if err := codec.NewDecoderBytes(rec.messages()[0], new(codec.MsgpackHandle)).Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	params, _ := req[3].([]interface{})
+	if len(params) != 2 || string(params[0].([]byte)) != "ab" || params[1] != int64(3) {
+		t.Fatalf("params on the wire = %v, want [ab 3]", req[3])
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	c, _ := newPair(t, new(Arith), nil)
+	rsp, err := c.Call("Arith.Multiply", Args{7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 56 {
+		t.Fatalf("rsp = %v, want 56", rsp)
+	}
+	for method, want := range map[string]string{
+		"Nope.Multiply": "rpc: can't find service Nope.Multiply",
+		"Arith.Nope":    "rpc: can't find method Arith.Nope",
+		"Multiply":      "rpc: service/method request ill-formed: Multiply",
+	} {
+		if _, err := c.Call(method, Args{7, 8}); err == nil || err.Error() != want {
+			t.Errorf("%s: err = %v, want %q", method, err, want)
+		}
+	}
+	// The server is still serving after the errors.
+	if _, err := c.Call("Arith.Multiply", Args{1, 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyDispatch(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	log := new(captureLogger)
+	sc := NewServerConn(b, nil, WithLogger(log))
+	defer sc.Close()
+	acks := make(Acker, 1)
+	sc.Register(acks)
+	sc.Register(new(Arith))
+	go sc.Serve()
+	tr := NewConnTransport(a, nil)
+	h := new(codec.MsgpackHandle)
+	send := func(frame ...interface{}) {
+		t.Helper()
+		var msg []byte
+		codec.NewEncoderBytes(&msg, h).Encode(frame)
+		if err := tr.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(msgpackRPCNotify, "Acker.Ack", []interface{}{Args{1, 2}})
+	select {
+	case got := <-acks:
+		if got != (Args{1, 2}) {
+			t.Fatalf("handler got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notify handler did not run")
+	}
+
+	send(msgpackRPCNotify, "Nope.Nope", []interface{}{1})
+	waitFor(t, "the unknown notification to be logged", func() bool { return len(log.logged()) > 0 })
+	if got := log.logged()[0]; !strings.Contains(got, "Nope.Nope") {
+		t.Fatalf("logged %q", got)
+	}
+
+	// Neither notification was answered: the next message is the
+	// response to this call.
+	send(msgpackRPCReq, 9, "Arith.Multiply", []interface{}{Args{2, 3}})
+	msg, err := tr.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rsp []interface{}
+	codec.NewDecoderBytes(msg, h).Decode(&rsp)
+	if rsp[0] != int64(msgpackRPCRsp) || rsp[1] != int64(9) {
+		t.Fatalf("first message from the server = %v, want the response to msgid 9", rsp)
+	}
+}
+
+type Amount struct {
+	Cents int
+}
+
+func (a Amount) Validate() error {
+	if a.Cents <= 0 {
+		return errors.New("amount must be positive")
+	}
+	return nil
+}
+
+type Bank struct{ calls int32 }
+
+func (b *Bank) Deposit(a Amount, reply *int) error {
+	atomic.AddInt32(&b.calls, 1)
+	*reply = a.Cents
+	return nil
+}
+
+func TestValidateBeforeHandler(t *testing.T) {
+	bank := new(Bank)
+	c, _ := newPair(t, bank, nil)
+	if _, err := c.Call("Bank.Deposit", Amount{-5}); err == nil || err.Error() != "amount must be positive" {
+		t.Fatalf("err = %v, want the validation error", err)
+	}
+	if n := atomic.LoadInt32(&bank.calls); n != 0 {
+		t.Fatalf("handler ran %d times for an invalid arg", n)
+	}
+	if _, err := c.Call("Bank.Deposit", Amount{5}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&bank.calls); n != 1 {
+		t.Fatalf("handler ran %d times for a valid arg, want once", n)
+	}
+}
+
+func TestNotifyStruct(t *testing.T) {
+	acks := make(Acker, 1)
+	c, rec := newRecordedPair(t, acks, nil)
+	if err := c.NotifyStruct("Acker.Ack", Args{4, 5}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-acks:
+		if got != (Args{4, 5}) {
+			t.Fatalf("handler got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notify handler did not run")
+	}
+	var frame []interface{}
+	if err := codec.NewDecoderBytes(rec.messages()[0], new(codec.MsgpackHandle)).Decode(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := frame[2].(map[interface{}]interface{}); !ok {
+		t.Fatalf("params on the wire = %#v, want the struct as a map", frame[2])
+	}
+}
+
+// Stamp is sent as a msgpack extension by stampExt.
+type Stamp int64
+
+type stampExt struct{}
+
+func (stampExt) WriteExt(v interface{}) []byte {
+	s, ok := v.(Stamp)
+	if !ok {
+		s = *v.(*Stamp)
+	}
+	return []byte(strconv.FormatInt(int64(s), 10))
+}
+
+func (stampExt) ReadExt(dst interface{}, src []byte) {
+	n, _ := strconv.ParseInt(string(src), 10, 64)
+	*dst.(*Stamp) = Stamp(n)
+}
+
+type Reading struct {
+	Where string
+	At    Stamp
+}
+
+type Sensors int
+
+func (*Sensors) Record(r Reading, reply *int64) error {
+	*reply = int64(r.At)
+	return nil
+}
+
+func TestStructArgWithExtension(t *testing.T) {
+	mpk := new(codec.MsgpackHandle)
+	if err := mpk.SetBytesExt(reflect.TypeOf(Stamp(0)), 1, stampExt{}); err != nil {
+		t.Fatal(err)
+	}
+	a, b := net.Pipe()
+	sc := NewServerConn(b, mpk)
+	sc.Register(new(Sensors))
+	go sc.Serve()
+	c := NewClient(a, mpk)
+	defer c.Close()
+	defer sc.Close()
+	rsp, err := c.Call("Sensors.Record", Reading{"attic", 1234})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 1234 {
+		t.Fatalf("reply = %v, want 1234", rsp)
+	}
+}
@@ -0,0 +1,19 @@
+package endpoint
+
+// drainingMethod is the reserved notification a server sends when it
+// starts draining, so clients stop sending and reconnect elsewhere.
+const drainingMethod = "$draining"
+
+// WithDrainingHandler calls fn when the peer announces it is draining. fn
+// runs on the read loop and must not block.
+func WithDrainingHandler(fn func()) Option {
+	return func(ep *endpoint) {
+		ep.onDraining = fn
+	}
+}
+
+// Drain tells the client that this server is draining. Calls already
+// made, and any the client still sends, are served as usual.
+func (sc *ServerConn) Drain() error {
+	return sc.ep.Notify(drainingMethod)
+}
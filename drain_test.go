@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrainingHandler(t *testing.T) {
+	draining := make(chan struct{}, 1)
+	c, sc := newPair(t, new(Arith), nil, WithDrainingHandler(func() { draining <- struct{}{} }))
+	if err := sc.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-draining:
+	case <-time.After(time.Second):
+		t.Fatal("draining handler did not fire")
+	}
+	// Calls still work while the server drains.
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	old, next := Backend(1), Backend(2)
+	c, sc := newPair(t, &old, nil)
+	successor, _ := newPair(t, &next, nil)
+	if rsp, err := c.Call("Backend.ID", 0); err != nil || rsp != int64(1) {
+		t.Fatalf("before migration rsp = %v, err = %v", rsp, err)
+	}
+	if err := sc.MigrateTo(successor); err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := c.Call("Backend.ID", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp != int64(2) {
+		t.Fatalf("during migration rsp = %v, want the successor's 2", rsp)
+	}
+}
+
+func TestMigrateToForwardsAsSent(t *testing.T) {
+	key := []byte("k")
+	c, sc := newPair(t, new(Whoami), []Option{WithReplayGuard(NewReplayGuard(key, time.Minute))},
+		WithRequestSigning(key), WithClientID("alice"))
+	successor, _ := newPair(t, new(Whoami), []Option{WithReplayGuard(NewReplayGuard(key, time.Minute))})
+	if err := sc.MigrateTo(successor); err != nil {
+		t.Fatal(err)
+	}
+	// The successor only accepts the request if params and metadata, which
+	// carry the client id and the signature, arrive unchanged.
+	rsp, err := c.Call("Whoami.ClientID", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := string(rsp.([]byte)); id != "alice" {
+		t.Fatalf("successor saw client id %q, want %q", id, "alice")
+	}
+}
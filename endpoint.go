@@ -1,12 +1,17 @@
 package endpoint
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
 	"net"
 	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
@@ -21,11 +26,15 @@ const msgpackRPCNotify = 2
 // because Typeof takes an empty interface value.  This is annoying.
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
 
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 type methodType struct {
 	sync.Mutex // protects counters
 	method     reflect.Method
 	ArgType    reflect.Type
-	ReplyType  reflect.Type
+	ReplyType  reflect.Type // nil for methods without a reply
+	ctx        bool         // takes a context.Context before the arg
+	fn         bool         // method.Func is a plain func without receiver
 	numCalls   uint
 }
 
@@ -38,31 +47,186 @@ type service struct {
 }
 
 type request struct {
-	done  chan int
-	msgid uint32
-	rsp   interface{}
-	err   error
+	done   chan int
+	msgid  uint32
+	method string
+	rsp    interface{}
+	err    error
+	stamp  time.Time // server clock, if the peer sent one
+
+	progress func(percent int)
+	meta     Metadata    // sent with the request, on top of ep.meta
+	size     int         // bytes of the reply, charged to ep.replies
+	prelude  []byte      // encoded message written just before the request
+	typed    bool        // set by CallResult: decode the reply into into
+	into     interface{} // nil discards the reply
 }
 
 type endpoint struct {
-	conn       net.Conn
-	mu         sync.Mutex
-	closed     bool
-	err        error
-	msgid      uint32
-	pendingmu  sync.Mutex
-	pending    map[uint32]*request
-	mpk        *codec.MsgpackHandle
-	serviceMap map[string]*service
-}
-
-func newEndpoint(conn net.Conn, mpk *codec.MsgpackHandle) (ep *endpoint) {
-	return &endpoint{
+	tr             Transport  // replaced on reconnect, under mu
+	conn           net.Conn   // nil unless tr wraps a net.Conn
+	mu             sync.Mutex // serializes writes to tr; guards serviceMap
+	msgid          uint32
+	pendingmu      sync.Mutex // protects closed and err
+	closed         bool
+	err            error
+	pending        [pendingShards]pendingShard
+	mpk            *codec.MsgpackHandle
+	encoders       sync.Pool // of *codec.Encoder writing to bytes
+	serviceMap     map[string]*service
+	workq          *workQueue
+	inflightmu     sync.Mutex
+	inflight       map[uint32]*RequestInfo
+	stringKeys     bool
+	maxServices    int
+	stamp          bool
+	gate           pauseGate
+	dupHook        func(msgid uint32)
+	blobs          BlobStore
+	blobMin        int
+	onDraining     func()
+	coalesce       coalescer
+	batch          replyBatcher
+	auditHook      func(AuditRecord)
+	meta           Metadata // sent with every request
+	replies        replyBudget
+	maxMethodLen   int
+	maxFrame       int
+	tcpReadBuf     int
+	tcpWriteBuf    int
+	logger         Logger
+	exitHook       func(err error, cause ExitCause)
+	argPools       map[reflect.Type]*sync.Pool // set by WithPreregisteredTypes
+	strict         *codec.MsgpackHandle        // decodes struct args; see argHandle
+	panicPolicy    PanicPolicy
+	dedup          *DedupCache
+	signKey        []byte       // set by WithRequestSigning
+	replay         *ReplayGuard // checks incoming requests
+	checkUTF8      bool
+	logUnknown     bool
+	handlerTimeout time.Duration
+	methodTimeouts map[string]time.Duration // per-method handler timeouts
+	errStacks      bool
+	callTimeout    time.Duration // applied to calls made without a context
+	startTimeout   time.Duration // bounds the wait for the read loop to start
+	readTimeout    time.Duration // bounds the wait for each incoming message
+	writeTimeout   time.Duration // bounds each write
+	decodeSem      chan struct{} // bounds concurrent reply decoding
+	hedges         *HedgeTracker
+	omitEmpty      bool
+	callHooks      []CallInterceptor
+	handlerHooks   []HandlerInterceptor
+	dial           DialFunc               // set for reconnecting clients
+	backoff        time.Duration          // between redial attempts
+	down           bool                   // reconnecting; guarded by mu
+	up             chan struct{}          // closed when down ends; guarded by mu
+	retries        int                    // set by WithCallRetry
+	correlate      bool                   // set by WithCallCorrelation
+	goodbye        bool                   // send $goodbye on Close
+	peerGone       atomic.Bool            // the peer sent $goodbye
+	writeFailed    atomic.Bool            // a write shut the endpoint down
+	successor      atomic.Pointer[Client] // set by MigrateTo
+	reliable       unacked                // sent by ReliableNotify
+	capMethod      string
+	capMu          sync.Mutex // serializes writes to capW
+	capW           io.Writer
+	faults         func(Phase) error // test-only fault injection
+	ready          chan struct{}     // closed once the read loop runs
+	readyOnce      sync.Once
+	done           chan struct{} // closed by shutdown
+}
+
+// ownHandle returns a copy of mpk, or a default handle if it is nil, set up
+// for an endpoint to use on its own, so the caller's handle is never
+// changed. The copy reads all of mpk, which must not be in use meanwhile.
+func ownHandle(mpk *codec.MsgpackHandle) (h *codec.MsgpackHandle) {
+	if mpk == nil {
+		h = new(codec.MsgpackHandle)
+	} else {
+		h = copyHandle(mpk)
+	}
+	if h.TypeInfos == nil {
+		h.TypeInfos = typeInfos
+	}
+	if h.ReaderBufferSize == 0 {
+		h.ReaderBufferSize = readBufferSize
+	}
+	// Parts encoded ahead, such as signed params, are sent as they are.
+	h.Raw = true
+	return
+}
+
+// newEndpoint returns an endpoint over tr using mpk, a handle from
+// ownHandle; nil means a default one. Without a transport the endpoint
+// starts out shut down with ErrNoConn, so every call fails cleanly.
+func newEndpoint(tr Transport, conn net.Conn, mpk *codec.MsgpackHandle, opts ...Option) (ep *endpoint) {
+	if mpk == nil {
+		mpk = ownHandle(nil)
+	}
+	ep = &endpoint{
+		tr:         tr,
 		conn:       conn,
 		mpk:        mpk,
-		pending:    make(map[uint32]*request),
 		serviceMap: make(map[string]*service),
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	ep.encoders.New = func() interface{} {
+		return codec.NewEncoderBytes(nil, ep.mpk)
+	}
+	// A copy of mpk with its extensions, made before anything uses mpk.
+	ep.strict = copyHandle(mpk)
+	ep.strict.ErrorIfNoField = true
+	for _, opt := range opts {
+		opt(ep)
+	}
+	if ep.logger == nil {
+		ep.logger = stdLogger{}
+	}
+	ep.tuneConn(conn)
+	ep.gate.init()
+	ep.replies.init()
+	ep.limitFrames(tr)
+	if tr == nil {
+		ep.shutdown(ErrNoConn)
+	}
+	return
+}
+
+// checkMethodLen applies WithMaxMethodNameLen to an incoming frame. A
+// request with an over-long name is answered with ErrMethodNameTooLong; a
+// notification is dropped.
+func (ep *endpoint) checkMethodLen(msg []byte) bool {
+	if ep.maxMethodLen <= 0 {
+		return true
 	}
+	typ, msgid, n, ok := peekMethodLen(msg)
+	if !ok || n <= ep.maxMethodLen {
+		return true
+	}
+	if typ == msgpackRPCReq {
+		ep.reply("", msgid, ErrMethodNameTooLong.Error(), nil)
+	}
+	return false
+}
+
+// schedule runs fn for an incoming request, unless dispatch is paused in
+// which case fn is held until Resume.
+func (ep *endpoint) schedule(fn func()) bool {
+	if ep.gate.hold(fn) {
+		return true
+	}
+	return ep.run(fn)
+}
+
+// run starts fn on the shared worker pool if one is configured or else on
+// a goroutine of its own.
+func (ep *endpoint) run(fn func()) bool {
+	if ep.workq != nil {
+		return ep.workq.submit(fn)
+	}
+	go fn()
+	return true
 }
 
 // Is this an exported - upper case - name?
@@ -71,14 +235,34 @@ func isExported(name string) bool {
 	return unicode.IsUpper(rune)
 }
 
-// Is this type exported or a builtin?
+// Is this type exported or a builtin? Pointers, slices, arrays, chans and
+// maps are looked through, so []*T or a named slice of T is only accepted
+// if T itself is.
 func isExportedOrBuiltinType(t reflect.Type) bool {
+	return exportedOrBuiltin(t, make(map[reflect.Type]bool))
+}
+
+func exportedOrBuiltin(t reflect.Type, seen map[reflect.Type]bool) bool {
 	for t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
+	if seen[t] {
+		// Recursive type; judged by its first occurrence.
+		return true
+	}
+	seen[t] = true
 	// PkgPath will be non-empty even for an exported type,
 	// so we need to check the type name as well.
-	return isExported(t.Name()) || t.PkgPath() == ""
+	if t.Name() != "" && !isExported(t.Name()) && t.PkgPath() != "" {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Chan:
+		return exportedOrBuiltin(t.Elem(), seen)
+	case reflect.Map:
+		return exportedOrBuiltin(t.Key(), seen) && exportedOrBuiltin(t.Elem(), seen)
+	}
+	return true
 }
 
 func (ep *endpoint) register(rcvr interface{}, name string, useName bool) error {
@@ -100,144 +284,928 @@ func (ep *endpoint) register(rcvr interface{}, name string, useName bool) error
 	}
 	if !isExported(sname) && !useName {
 		s := "rpc.Register: type " + sname + " is not exported"
-		log.Print(s)
+		ep.logger.Printf("%s", s)
 		return errors.New(s)
 	}
 	if _, present := ep.serviceMap[sname]; present {
-		return errors.New("rpc: service already defined: " + sname)
+		return fmt.Errorf("%w: %s", ErrDuplicateService, sname)
+	}
+	if ep.maxServices > 0 && len(ep.serviceMap) >= ep.maxServices {
+		return ErrTooManyServices
 	}
 	s.name = sname
 
 	// Install the methods
-	s.method = suitableMethods(s.typ, true)
+	s.method = suitableMethods(s.typ, ep.logger)
+	s.notify = notifyMethods(s.method)
 
 	if len(s.method) == 0 {
 		str := ""
 
 		// To help the user, see if a pointer receiver would work.
-		method := suitableMethods(reflect.PtrTo(s.typ), false)
+		method := suitableMethods(reflect.PtrTo(s.typ), nil)
 		if len(method) != 0 {
 			str = "rpc.Register: type " + sname + " has no exported methods of suitable type (hint: pass a pointer to value of that type)"
 		} else {
 			str = "rpc.Register: type " + sname + " has no exported methods of suitable type"
 		}
-		log.Print(str)
+		ep.logger.Printf("%s", str)
 		return errors.New(str)
 	}
 	ep.serviceMap[s.name] = s
 	return nil
 }
 
+// MethodSignature returns the arg and reply types of the registered method
+// named "Service.Method". replyType is nil for methods without a reply.
+func (ep *endpoint) MethodSignature(fullName string) (argType, replyType reflect.Type, ok bool) {
+	dot := strings.LastIndex(fullName, ".")
+	if dot < 0 {
+		return
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	s := ep.serviceMap[fullName[:dot]]
+	if s == nil {
+		return
+	}
+	mtype := s.method[fullName[dot+1:]]
+	if mtype == nil {
+		return
+	}
+	return mtype.ArgType, mtype.ReplyType, true
+}
+
 // suitableMethods returns suitable Rpc methods of typ, it will report
-// error using log if reportErr is true.
-func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
+// error to logger unless it is nil.
+func suitableMethods(typ reflect.Type, logger Logger) map[string]*methodType {
 	methods := make(map[string]*methodType)
 	for m := 0; m < typ.NumMethod(); m++ {
 		method := typ.Method(m)
-		mtype := method.Type
-		mname := method.Name
 		// Method must be exported.
 		if method.PkgPath != "" {
 			continue
 		}
-		// Second arg must be a pointer.
-		replyType := mtype.In(2)
-		if replyType.Kind() != reflect.Ptr {
-			if reportErr {
-				log.Println("method", mname, "reply type not a pointer:", replyType)
-			}
-			continue
+		if mt := suitableMethod(method, 1, logger); mt != nil {
+			methods[method.Name] = mt
 		}
-		// Reply type must be exported.
-		if !isExportedOrBuiltinType(replyType) {
-			if reportErr {
-				log.Println("method", mname, "reply type not exported:", replyType)
-			}
-			continue
+	}
+	return methods
+}
+
+// notifyMethods returns the methods that can handle notifications: those
+// without a reply, func(arg) or func(ctx, arg). They can also be called,
+// replying with nil.
+func notifyMethods(methods map[string]*methodType) map[string]*methodType {
+	notify := make(map[string]*methodType)
+	for name, mt := range methods {
+		if mt.ReplyType == nil {
+			notify[name] = mt
 		}
-		// Method needs one out.
-		if mtype.NumOut() != 1 {
-			if reportErr {
-				log.Println("method", mname, "has wrong number of outs:", mtype.NumOut())
-			}
-			continue
+	}
+	return notify
+}
+
+// suitableMethod checks whether method can be served and returns its
+// methodType, or nil if it cannot. first is the index of the first
+// argument after the receiver: 1 for methods, 0 for plain funcs.
+func suitableMethod(method reflect.Method, first int, logger Logger) *methodType {
+	mtype := method.Type
+	mname := method.Name
+	// A context.Context may come before the arg.
+	in := first
+	takesCtx := mtype.NumIn() > in && mtype.In(in) == typeOfContext
+	if takesCtx {
+		in++
+	}
+	// Method needs an arg, and a reply unless it has no outs.
+	if mtype.NumIn() != in+1 && mtype.NumIn() != in+2 {
+		if logger != nil {
+			logger.Printf("method %s has wrong number of ins: %d", mname, mtype.NumIn())
 		}
-		// The return type of the method must be error.
-		if returnType := mtype.Out(0); returnType != typeOfError {
-			if reportErr {
-				log.Println("method", mname, "returns", returnType.String(), "not error")
+		return nil
+	}
+	// First arg need not be a pointer.
+	argType := mtype.In(in)
+	if !isExportedOrBuiltinType(argType) {
+		if logger != nil {
+			logger.Printf("%s argument type not exported: %v", mname, argType)
+		}
+		return nil
+	}
+	// A method with an arg but no results is an acknowledged call:
+	// it always replies with a nil result and a nil error.
+	if mtype.NumIn() == in+1 {
+		if mtype.NumOut() != 0 {
+			if logger != nil {
+				logger.Printf("method %s has no reply but has outs: %d", mname, mtype.NumOut())
 			}
-			continue
+			return nil
 		}
-		methods[mname] = &methodType{method: method, ArgType: argType, ReplyType: replyType}
+		return &methodType{method: method, ArgType: argType, ctx: takesCtx, fn: first == 0}
 	}
-	return methods
+	// Second arg must be a pointer.
+	replyType := mtype.In(in + 1)
+	if replyType.Kind() != reflect.Ptr {
+		if logger != nil {
+			logger.Printf("method %s reply type not a pointer: %v", mname, replyType)
+		}
+		return nil
+	}
+	// Reply type must be exported.
+	if !isExportedOrBuiltinType(replyType) {
+		if logger != nil {
+			logger.Printf("method %s reply type not exported: %v", mname, replyType)
+		}
+		return nil
+	}
+	// Method needs one out.
+	if mtype.NumOut() != 1 {
+		if logger != nil {
+			logger.Printf("method %s has wrong number of outs: %d", mname, mtype.NumOut())
+		}
+		return nil
+	}
+	// The return type of the method must be error.
+	if returnType := mtype.Out(0); returnType != typeOfError {
+		if logger != nil {
+			logger.Printf("method %s returns %s not error", mname, returnType.String())
+		}
+		return nil
+	}
+	return &methodType{method: method, ArgType: argType, ReplyType: replyType, ctx: takesCtx, fn: first == 0}
+}
+
+// registerFunc registers fn as the method name ("Service.Method"). The
+// service is created if needed; registering a method name that is already
+// taken, by either kind of registration, fails with ErrDuplicateMethod.
+func (ep *endpoint) registerFunc(fn interface{}, name string) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fmt.Errorf("rpc.RegisterMethod: %T is not a func", fn)
+	}
+	dot := strings.LastIndex(name, ".")
+	if dot <= 0 || dot == len(name)-1 {
+		return errors.New("rpc.RegisterMethod: method name " + name + " is not of the form Service.Method")
+	}
+	sname, mname := name[:dot], name[dot+1:]
+	mt := suitableMethod(reflect.Method{Name: mname, Type: v.Type(), Func: v}, 0, ep.logger)
+	if mt == nil {
+		str := "rpc.RegisterMethod: " + name + " is not of suitable type"
+		ep.logger.Printf("%s", str)
+		return errors.New(str)
+	}
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	s := ep.serviceMap[sname]
+	if s == nil {
+		if ep.maxServices > 0 && len(ep.serviceMap) >= ep.maxServices {
+			return ErrTooManyServices
+		}
+		s = &service{name: sname, method: make(map[string]*methodType), notify: make(map[string]*methodType)}
+		ep.serviceMap[sname] = s
+	}
+	if _, present := s.method[mname]; present {
+		return fmt.Errorf("%w: %s", ErrDuplicateMethod, name)
+	}
+	s.method[mname] = mt
+	if mt.ReplyType == nil {
+		s.notify[mname] = mt
+	}
+	return nil
+}
+
+// funcName derives "Service.Method" for fn from its symbol name, so that a
+// method value such as arith.Multiply registers as "Arith.Multiply" and a
+// plain function pkg.Multiply as "pkg.Multiply".
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+	name := runtime.FuncForPC(v.Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return name
+	}
+	if len(parts) >= 3 {
+		// pkg.(*Type).Method or pkg.Type.Method
+		return strings.Trim(parts[len(parts)-2], "(*)") + "." + parts[len(parts)-1]
+	}
+	return name
+}
+
+// send encodes and writes one message. method names the call the message
+// belongs to and is only used for wire capture.
+func (ep *endpoint) send(method string, reqobj []interface{}) (err error) {
+	msg, err := ep.encode(method, reqobj)
+	if err != nil {
+		return
+	}
+	err = ep.write(msg)
+	return
 }
 
-func (ep *endpoint) send(reqobj []interface{}) (err error) {
-	enc := codec.NewEncoder(ep.conn, ep.mpk)
+// encode encodes one message for send or write, signed if
+// WithRequestSigning is set.
+func (ep *endpoint) encode(method string, reqobj []interface{}) (msg []byte, err error) {
+	if err = ep.fault(PhaseEncode); err != nil {
+		return
+	}
+	if ep.signKey != nil {
+		if reqobj, err = ep.signFrame(reqobj); err != nil {
+			return
+		}
+	}
+	if msg, err = ep.marshal(reqobj); err != nil {
+		return
+	}
+	ep.capture(method, msg)
+	return
+}
+
+// marshal encodes a message, or part of one, as it goes on the wire.
+func (ep *endpoint) marshal(obj interface{}) (msg []byte, err error) {
+	if ep.omitEmpty {
+		obj = omitEmptyValue(obj)
+	}
+	enc := ep.encoders.Get().(*codec.Encoder)
+	enc.ResetBytes(&msg)
+	if err = enc.Encode(obj); err != nil {
+		return
+	}
+	enc.ResetBytes(nil) // don't keep msg alive from the pool
+	ep.encoders.Put(enc)
+	return
+}
+
+// write writes encoded messages back to back; no other message can come
+// between them.
+func (ep *endpoint) write(msgs ...[]byte) (err error) {
 	ep.mu.Lock()
 	defer ep.mu.Unlock()
+	if err = ep.closedErr(); err != nil {
+		return
+	}
+	if ep.down {
+		return ErrConnClosed
+	}
+	if ep.writeTimeout > 0 && ep.conn != nil {
+		ep.conn.SetWriteDeadline(time.Now().Add(ep.writeTimeout))
+	}
+	if bw, ok := ep.tr.(batchWriter); ok && len(msgs) > 1 {
+		if err = ep.fault(PhaseWrite); err == nil {
+			err = bw.WriteMessages(msgs)
+		}
+	} else {
+		for _, msg := range msgs {
+			if err = ep.fault(PhaseWrite); err == nil {
+				err = ep.tr.WriteMessage(msg)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil && ep.dial != nil {
+		// The read loop notices the closed transport and reconnects.
+		ep.tr.Close()
+		err = fmt.Errorf("%w: write: %v", ErrConnClosed, err)
+	} else if err != nil {
+		// A failed write leaves the stream unusable. Keep the transport's
+		// error in the chain so callers can test it with errors.Is.
+		err = fmt.Errorf("rpc: write: %w", err)
+		ep.writeFailed.Store(true)
+		ep.shutdown(err)
+		// Closing the transport ends the read loop too, instead of leaving
+		// it to dispatch requests on a shut-down endpoint.
+		ep.tr.Close()
+	}
+	return
+}
+
+// closedErr returns the reason the endpoint was shut down, or nil.
+func (ep *endpoint) closedErr() (err error) {
+	ep.pendingmu.Lock()
 	if ep.closed {
 		err = ep.err
-		return
 	}
-	err = enc.Encode(reqobj)
+	ep.pendingmu.Unlock()
 	return
 }
 
-func (ep *endpoint) Call(method string, params ...interface{}) (rsp interface{}, err error) {
-	msgid := atomic.AddUint32(&ep.msgid, 1)
-	reqobj := []interface{}{msgpackRPCReq, msgid, method, params}
+// shutdown is the only place the endpoint becomes closed. It records err
+// as the reason and fails every pending call with it; a call registered
+// before this point is failed here, one registered after sees ep.err.
+// Only the first shutdown has any effect.
+func (ep *endpoint) shutdown(err error) {
 	ep.pendingmu.Lock()
 	if ep.closed {
 		ep.pendingmu.Unlock()
-		err = ep.err
 		return
 	}
-	req := &request{
-		done:  make(chan int),
-		msgid: msgid,
-		rsp:   nil,
-		err:   nil,
-	}
-	ep.pending[msgid] = req
+	ep.closed = true
+	ep.err = err
 	ep.pendingmu.Unlock()
-	err = ep.send(reqobj)
+	close(ep.done)
+	for _, req := range ep.closePending(err) {
+		req.err = err
+		close(req.done)
+	}
+	ep.gate.close()
+	ep.replies.close()
+	if ep.workq != nil {
+		ep.workq.release()
+	}
+}
+
+// Close shuts the endpoint down with ErrShutdown and closes the transport,
+// first telling the peer with WithGoodbyeNotify.
+func (ep *endpoint) Close() (err error) {
+	ep.flushReplies()
+	ep.sayGoodbye()
+	ep.shutdown(ErrShutdown)
+	err = ep.closeTransport()
+	return
+}
+
+// Err returns why the endpoint was shut down, or nil while it runs.
+func (ep *endpoint) Err() error {
+	return ep.closedErr()
+}
+
+// Done returns a channel closed once the endpoint has shut down.
+func (ep *endpoint) Done() <-chan struct{} {
+	return ep.done
+}
+
+// closeTransport closes the current transport. With reconnect the read
+// loop may replace ep.tr, so other goroutines read it under ep.mu.
+func (ep *endpoint) closeTransport() error {
+	ep.mu.Lock()
+	tr := ep.tr
+	ep.mu.Unlock()
+	if tr == nil {
+		return nil
+	}
+	return tr.Close()
+}
+
+// reply sends the response to the request msgid for method. With
+// WithServerTimestamp the local clock is appended as a trailing fifth
+// element.
+func (ep *endpoint) reply(method string, msgid uint32, rerr interface{}, result interface{}) (err error) {
+	if ep.checkUTF8 && !validStrings(result) {
+		rerr, result = ErrInvalidUTF8.Error(), nil
+	}
+	rspobj := []interface{}{msgpackRPCRsp, msgid, nilIfEmpty(rerr), nilIfEmpty(result)}
+	if ep.stamp {
+		rspobj = append(rspobj, time.Now())
+	}
+	if ep.batch.window <= 0 {
+		err = ep.send(method, rspobj)
+		return
+	}
+	msg, err := ep.encode(method, rspobj)
+	if err == nil {
+		ep.queueReply(msg)
+	}
+	return
+}
+
+// nilIfEmpty turns typed nils (a nil *T, map, slice, ...) into an untyped
+// nil, so a missing reply or error is always encoded as msgpack nil and
+// never as an empty map or array.
+func nilIfEmpty(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Chan, reflect.Func:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+	return v
+}
+
+// Call calls method and waits for its reply, for at most the timeout set
+// with WithCallTimeout.
+func (ep *endpoint) Call(method string, params ...interface{}) (rsp interface{}, err error) {
+	if ep.callTimeout <= 0 {
+		return ep.CallContext(context.Background(), method, params...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ep.callTimeout)
+	defer cancel()
+	if rsp, err = ep.CallContext(ctx, method, params...); err == context.DeadlineExceeded {
+		err = ErrCallTimeout
+	}
+	return
+}
+
+// CallResult is Call, decoding the reply straight into result, which must
+// be a pointer, so it can be a typed struct instead of loosely decoded
+// maps. A nil result discards the reply. If the call fails, result is not
+// touched.
+func (ep *endpoint) CallResult(method string, result interface{}, params ...interface{}) (err error) {
+	if result != nil && reflect.TypeOf(result).Kind() != reflect.Ptr {
+		return fmt.Errorf("rpc: CallResult: result must be a pointer, not %T", result)
+	}
+	req := &request{typed: true, into: result}
+	_, err = ep.roundTrip(context.Background(), req, method, params, ep.await)
+	return
+}
+
+// CallContext is Call, giving up when ctx is done. The call is then
+// removed from the pending calls, its response is dropped on arrival and
+// ctx.Err() is returned. The request itself still runs on the peer.
+func (ep *endpoint) CallContext(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	if ep.coalesce.window > 0 {
+		return ep.intercept(ctx, method, params, func() (interface{}, error) {
+			return ep.coalescedCall(ctx, method, params)
+		})
+	}
+	wait := func(req *request) (interface{}, error) {
+		return ep.waitContext(ctx, req)
+	}
+	return ep.roundTrip(ctx, new(request), method, params, wait)
+}
+
+// await is wait for calls made without a context, failing req with
+// ErrCallTimeout once the WithCallTimeout timeout elapses.
+func (ep *endpoint) await(req *request) (rsp interface{}, err error) {
+	if ep.callTimeout <= 0 {
+		return ep.wait(req)
+	}
+	t := time.NewTimer(ep.callTimeout)
+	defer t.Stop()
+	select {
+	case <-req.done:
+	case <-t.C:
+		ep.abandon(req, ErrCallTimeout)
+	}
+	return ep.wait(req)
+}
+
+// waitContext is wait, abandoning req with ctx.Err() when ctx is done
+// first.
+func (ep *endpoint) waitContext(ctx context.Context, req *request) (rsp interface{}, err error) {
+	select {
+	case <-req.done:
+	case <-ctx.Done():
+		ep.abandon(req, ctx.Err())
+	}
+	return ep.wait(req)
+}
+
+// start registers req as pending under a fresh msgid and sends it.
+func (ep *endpoint) start(req *request, method string, params []interface{}) (err error) {
+	msg, err := ep.prepare(req, method, params)
 	if err != nil {
-		ep.pendingmu.Lock()
-		delete(ep.pending, req.msgid)
-		ep.pendingmu.Unlock()
 		return
 	}
+	if req.prelude != nil {
+		err = ep.write(req.prelude, msg)
+	} else {
+		err = ep.write(msg)
+	}
+	if err != nil {
+		ep.takePending(req.msgid)
+		return
+	}
+	return
+}
+
+// prepare registers req as pending under a fresh msgid and returns its
+// encoded request, for the caller to write.
+func (ep *endpoint) prepare(req *request, method string, params []interface{}) (msg []byte, err error) {
+	if ep.checkUTF8 && !validStrings(params) {
+		return nil, ErrInvalidUTF8
+	}
+	if params, err = ep.offload(params); err != nil {
+		return
+	}
+	ep.replies.acquire()
+	req.done = make(chan int)
+	req.method = method
+	if err = ep.addPending(req); err != nil {
+		return
+	}
+	reqobj := []interface{}{msgpackRPCReq, req.msgid, method, wireParams(params)}
+	if md := ep.requestMetadata(req); len(md) > 0 {
+		reqobj = append(reqobj, md)
+	}
+	if msg, err = ep.encode(method, reqobj); err != nil {
+		ep.takePending(req.msgid)
+	}
+	return
+}
+
+// EncodedSize returns how many bytes a Call of method with params would put
+// on the wire, without sending anything. Params large enough to go to a
+// BlobStore are counted inline.
+func (ep *endpoint) EncodedSize(method string, params ...interface{}) (n int, err error) {
+	msgid := atomic.LoadUint32(&ep.msgid) + 1
+	reqobj := []interface{}{msgpackRPCReq, msgid, method, wireParams(params)}
+	if md := ep.requestMetadata(&request{method: method}); len(md) > 0 {
+		reqobj = append(reqobj, md)
+	}
+	if ep.signKey != nil {
+		if reqobj, err = ep.signFrame(reqobj); err != nil {
+			return
+		}
+	}
+	msg, err := ep.marshal(reqobj)
+	n = len(msg)
+	return
+}
+
+// wait blocks until req is answered or abandoned.
+func (ep *endpoint) wait(req *request) (rsp interface{}, err error) {
 	<-req.done
+	ep.replies.release(req.size)
 	rsp = req.rsp
 	err = req.err
+	if ep.stringKeys {
+		rsp = stringifyKeys(rsp)
+	}
+	return
+}
+
+// complete hands a response to the call pending on msgid. The entry is
+// removed from ep.pending before done is closed, so only the first response
+// for a msgid is delivered; any later one finds no entry and is passed to
+// the duplicate response hook instead. With WithConcurrentReplyDecode fill
+// runs off the read loop.
+func (ep *endpoint) complete(msgid uint32, fill func(req *request)) {
+	req := ep.takePending(msgid)
+	if req == nil {
+		if ep.logUnknown {
+			ep.logger.Printf("rpc: dropping response for unknown msgid %d", msgid)
+		}
+		if ep.dupHook != nil {
+			ep.dupHook(msgid)
+		}
+		return
+	}
+	if ep.decodeSem == nil {
+		fill(req)
+		close(req.done)
+		return
+	}
+	// The entry is already taken, so fill may run concurrently with the
+	// read loop and with other replies.
+	ep.decodeSem <- struct{}{}
+	go func() {
+		fill(req)
+		close(req.done)
+		<-ep.decodeSem
+	}()
+}
+
+// CallWithServerTime is Call, additionally returning the time the peer
+// stamped on its response. serverTime is zero unless the peer was set up
+// with WithServerTimestamp.
+func (ep *endpoint) CallWithServerTime(method string, params ...interface{}) (rsp interface{}, serverTime time.Time, err error) {
+	req := new(request)
+	rsp, err = ep.roundTrip(context.Background(), req, method, params, ep.await)
+	serverTime = req.stamp
 	return
 }
 
+// abandon fails req with err unless its response has already arrived. The
+// pending entry is removed first, so a late response is simply dropped.
+func (ep *endpoint) abandon(req *request, err error) {
+	if ep.takePending(req.msgid) == req {
+		req.err = err
+		close(req.done)
+	}
+}
+
+// Speculate sends a call right away without waiting for it. commit waits
+// for and returns the reply; cancel discards it. msgpack-rpc has no way to
+// cancel a request remotely, so a cancelled call still runs on the peer and
+// its response is dropped on arrival. A reply that arrived before cancel
+// is discarded and its bytes returned to WithMaxPendingReplyBytes.
+func (ep *endpoint) Speculate(method string, params ...interface{}) (commit func() (interface{}, error), cancel func()) {
+	req := new(request)
+	err := ep.start(req, method, params)
+	var once sync.Once
+	var rsp interface{}
+	var rerr error
+	settle := func() {
+		once.Do(func() { rsp, rerr = ep.wait(req) })
+	}
+	commit = func() (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		settle()
+		return rsp, rerr
+	}
+	cancel = func() {
+		if err == nil {
+			ep.abandon(req, ErrCanceled)
+			settle()
+		}
+	}
+	return
+}
+
+// Notify sends a notification. Messages sent from one goroutine are
+// written in the order they are sent, so a Notify followed by a Call
+// reaches the peer in that order.
 func (ep *endpoint) Notify(method string, params ...interface{}) (err error) {
-	reqobj := []interface{}{msgpackRPCNotify, method, params}
-	err = ep.send(reqobj)
+	if ep.checkUTF8 && !validStrings(params) {
+		return ErrInvalidUTF8
+	}
+	reqobj := []interface{}{msgpackRPCNotify, method, wireParams(params)}
+	err = ep.send(method, reqobj)
 	return err
 }
 
-func (ep *endpoint) Register(svc interface{}) (err error) {
+// NotifyStruct is Notify with arg sent as the params itself rather than
+// as the only element of a params array, so a struct travels as a map.
+// Handlers taking a single arg decode it either way.
+func (ep *endpoint) NotifyStruct(method string, arg interface{}) (err error) {
+	if ep.checkUTF8 && !validStrings(arg) {
+		return ErrInvalidUTF8
+	}
+	reqobj := []interface{}{msgpackRPCNotify, method, arg}
+	err = ep.send(method, reqobj)
 	return
 }
 
+// NotifyThenCall sends the notification notify with notifyParams
+// immediately followed by a call of method, and waits for the call's
+// reply. Both are written under one lock, so no message sent concurrently
+// by another goroutine can come between them.
+func (ep *endpoint) NotifyThenCall(notify string, notifyParams []interface{}, method string, params ...interface{}) (rsp interface{}, err error) {
+	if ep.checkUTF8 && !validStrings(notifyParams) {
+		return nil, ErrInvalidUTF8
+	}
+	req := new(request)
+	nobj := []interface{}{msgpackRPCNotify, notify, wireParams(notifyParams)}
+	if req.prelude, err = ep.encode(notify, nobj); err != nil {
+		return
+	}
+	return ep.roundTrip(context.Background(), req, method, params, ep.await)
+}
+
+// Register publishes the suitable methods of svc under the name of its
+// concrete type.
+func (ep *endpoint) Register(svc interface{}) (err error) {
+	return ep.register(svc, "", false)
+}
+
+// RegisterName is like Register but uses name for the service.
 func (ep *endpoint) RegisterName(svc interface{}, name string) (err error) {
-	return
+	return ep.register(svc, name, true)
 }
 
+// RegisterMethod registers a single func or method value under a name
+// derived from it; see funcName.
 func (ep *endpoint) RegisterMethod(svc interface{}) (err error) {
-	return
+	return ep.registerFunc(svc, funcName(svc))
 }
 
+// RegisterMethodName registers a single func or method value as name,
+// which must be of the form "Service.Method".
 func (ep *endpoint) RegisterMethodName(method interface{}, name string) (err error) {
-	return
+	return ep.registerFunc(method, name)
+}
+
+// markReady signals that the read loop is running.
+func (ep *endpoint) markReady() {
+	ep.readyOnce.Do(func() { close(ep.ready) })
+}
+
+// checkStart is run by the read loop before it counts as started. With a
+// start timeout set, a connection that is already closed fails the start
+// with ErrStartTimeout, instead of the first call failing later.
+func (ep *endpoint) checkStart() error {
+	if ep.startTimeout <= 0 || ep.conn == nil {
+		return nil
+	}
+	// Clearing the deadline does nothing to an open connection and fails
+	// on a closed one.
+	if err := ep.conn.SetReadDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("%w: %v", ErrStartTimeout, err)
+	}
+	return nil
+}
+
+// waitReady waits for the read loop to start. If it has not within the
+// start timeout, the endpoint is shut down with ErrStartTimeout.
+func (ep *endpoint) waitReady() {
+	if ep.startTimeout <= 0 {
+		<-ep.ready
+		return
+	}
+	t := time.NewTimer(ep.startTimeout)
+	defer t.Stop()
+	select {
+	case <-ep.ready:
+	case <-t.C:
+		ep.shutdown(ErrStartTimeout)
+		ep.closeTransport()
+	}
 }
 
+// Reading runs the read loop until the transport fails or closed is
+// closed. It returns the reason the endpoint was shut down: ErrShutdown
+// after Close, otherwise the read or decode error, which also fails every
+// pending call.
 func (ep *endpoint) Reading(closed chan int) (err error) {
+	if ep.tr == nil {
+		ep.markReady()
+		return ErrNoConn
+	}
+	exit := make(chan struct{})
+	defer close(exit)
+	go func() {
+		select {
+		case <-closed:
+			ep.Close()
+		case <-exit:
+		}
+	}()
+	if err = ep.checkStart(); err != nil {
+		ep.shutdown(err)
+	}
+	ep.markReady()
+	decode := false
+	for err == nil {
+		var msg []byte
+		if ep.readTimeout > 0 && ep.conn != nil {
+			// Only this goroutine replaces ep.conn, when it reconnects.
+			ep.conn.SetReadDeadline(time.Now().Add(ep.readTimeout))
+		}
+		if err = ep.fault(PhaseRead); err == nil {
+			msg, err = ep.tr.ReadMessage()
+		}
+		if err == nil && ep.maxFrame > 0 && len(msg) > ep.maxFrame {
+			err = ErrFrameTooLarge
+		}
+		if err == ErrFrameTooLarge {
+			break
+		}
+		if err != nil {
+			if ep.dial == nil && ep.peerGone.Load() {
+				err = ErrPeerClosed
+				break
+			}
+			if ep.dial != nil && ep.closedErr() == nil && ep.reconnect(err) {
+				err = nil
+				continue
+			}
+			err = fmt.Errorf("rpc: read: %w", err)
+			break
+		}
+		if err = ep.handle(msg); err != nil {
+			decode = true
+			break
+		}
+	}
+	ep.shutdown(err)
+	ep.closeTransport()
+	err = ep.closedErr()
+	if ep.exitHook != nil {
+		ep.exitHook(err, ep.exitCause(err, decode))
+	}
 	return
 }
+
+// handle decodes one incoming frame and acts on it. An error is returned
+// only for a frame that cannot be decoded at all, which ends the read loop.
+func (ep *endpoint) handle(msg []byte) (err error) {
+	if !ep.checkMethodLen(msg) {
+		return
+	}
+	var parts []codec.Raw
+	if err = ep.fault(PhaseDecode); err == nil {
+		err = codec.NewDecoderBytes(msg, ep.mpk).Decode(&parts)
+	}
+	var typ int
+	if err == nil && len(parts) > 0 {
+		err = ep.decodeRaw(parts[0], &typ)
+	}
+	if err != nil {
+		err = fmt.Errorf("rpc: decode: %w", err)
+		return
+	}
+	switch {
+	case typ == msgpackRPCRsp && len(parts) >= 4:
+		err = ep.handleResponse(msg, parts)
+	case typ == msgpackRPCReq && len(parts) >= 4:
+		err = ep.handleRequest(msg, parts)
+	case typ == msgpackRPCNotify && len(parts) >= 3:
+		err = ep.handleNotify(msg, parts)
+	default:
+		err = fmt.Errorf("rpc: decode: malformed message of type %d with %d elements", typ, len(parts))
+	}
+	return
+}
+
+// decodeRaw decodes one element of a frame into v. A nil element comes
+// out of the frame as an empty Raw and leaves v untouched.
+func (ep *endpoint) decodeRaw(raw codec.Raw, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return codec.NewDecoderBytes(raw, ep.mpk).Decode(v)
+}
+
+// handleResponse delivers [1, msgid, error, result] to its pending call. A
+// result that cannot be decoded fails that call only.
+func (ep *endpoint) handleResponse(msg []byte, parts []codec.Raw) (err error) {
+	var msgid uint32
+	var rerr interface{}
+	if err = ep.decodeRaw(parts[1], &msgid); err != nil {
+		return fmt.Errorf("rpc: decode: response msgid: %w", err)
+	}
+	if err = ep.decodeRaw(parts[2], &rerr); err != nil {
+		return fmt.Errorf("rpc: decode: response error: %w", err)
+	}
+	var stamp time.Time
+	if len(parts) > 4 {
+		ep.decodeRaw(parts[4], &stamp)
+	}
+	if ep.auditHook != nil || ep.capW != nil {
+		if req := ep.lookupPending(msgid); req != nil {
+			ep.audit(AuditResponse, msgid, req.method, nil, parts[2], parts[3])
+			ep.capture(req.method, msg)
+		}
+	}
+	ep.complete(msgid, func(req *request) {
+		req.size = len(parts[3])
+		ep.replies.add(req.size)
+		req.stamp = stamp
+		if rerr != nil {
+			req.err = remoteError(req.method, rerr)
+			return
+		}
+		var derr error
+		if !req.typed {
+			derr = ep.decodeRaw(parts[3], &req.rsp)
+		} else if req.into != nil {
+			derr = ep.decodeRaw(parts[3], req.into)
+		}
+		if derr != nil {
+			req.err = fmt.Errorf("rpc: decode: response result: %w", derr)
+		}
+	})
+	return
+}
+
+// RemoteError is an error returned by the peer's handler, as opposed to a
+// failure to reach it. Calls fail with a *RemoteError whenever a response
+// carries an error.
+type RemoteError struct {
+	Method  string // method of the failed call
+	Message string // the error as sent by the peer
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// UnknownRPCError is the error of a call whose response carried an error
+// that is neither a string nor a map with a message, such as a number. Raw
+// is the error as decoded; Message is its printed form. It unwraps to its
+// *RemoteError.
+type UnknownRPCError struct {
+	RemoteError
+	Raw interface{}
+}
+
+func (e *UnknownRPCError) Unwrap() error {
+	return &e.RemoteError
+}
+
+// remoteError turns the error element of a response to method into a
+// *RemoteError. Peers normally send a string, which the default handle
+// decodes as []byte; a map of message and stack comes from a peer using
+// WithErrorStacks, and the stack is kept. Anything else becomes an
+// *UnknownRPCError.
+func remoteError(method string, v interface{}) error {
+	if m, ok := v.(map[interface{}]interface{}); ok {
+		if msg, ok := m[errKeyMessage]; ok {
+			err := &RemoteError{Method: method, Message: keyString(msg)}
+			if stack, ok := m[errKeyStack]; ok {
+				return &stackError{err: err, stack: keyString(stack)}
+			}
+			return err
+		}
+	}
+	switch v.(type) {
+	case string, []byte:
+		return &RemoteError{Method: method, Message: keyString(v)}
+	}
+	return &UnknownRPCError{RemoteError: RemoteError{Method: method, Message: keyString(v)}, Raw: v}
+}
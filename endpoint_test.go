@@ -0,0 +1,285 @@
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith int
+
+func (*Arith) Multiply(args Args, reply *int) error {
+	*reply = args.A * args.B
+	return nil
+}
+
+func (*Arith) Divide(args Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+// newPair connects a Client to a ServerConn serving svc over net.Pipe.
+// Both are closed when the test ends.
+func newPair(t testing.TB, svc interface{}, srvOpts []Option, cliOpts ...Option) (*Client, *ServerConn) {
+	t.Helper()
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil, srvOpts...)
+	if svc != nil {
+		if err := sc.Register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go sc.Serve()
+	c := NewClient(a, nil, cliOpts...)
+	t.Cleanup(func() {
+		c.Close()
+		sc.Close()
+	})
+	return c, sc
+}
+
+// pendingCount returns the number of calls waiting for a response.
+func (ep *endpoint) pendingCount() (n int) {
+	for i := range ep.pending {
+		ep.pending[i].mu.Lock()
+		n += len(ep.pending[i].m)
+		ep.pending[i].mu.Unlock()
+	}
+	return
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recorder is a Transport that keeps a copy of every message written.
+type recorder struct {
+	Transport
+	mu   sync.Mutex
+	sent [][]byte
+}
+
+func (r *recorder) WriteMessage(msg []byte) error {
+	r.mu.Lock()
+	r.sent = append(r.sent, append([]byte(nil), msg...))
+	r.mu.Unlock()
+	return r.Transport.WriteMessage(msg)
+}
+
+func (r *recorder) messages() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.sent...)
+}
+
+// newRecordedPair is newPair with the client's writes recorded.
+func newRecordedPair(t testing.TB, svc interface{}, srvOpts []Option, cliOpts ...Option) (*Client, *recorder) {
+	t.Helper()
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil, srvOpts...)
+	if svc != nil {
+		if err := sc.Register(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go sc.Serve()
+	rec := &recorder{Transport: NewConnTransport(a, nil)}
+	c := NewClientTransport(rec, nil, cliOpts...)
+	t.Cleanup(func() {
+		c.Close()
+		sc.Close()
+	})
+	return c, rec
+}
+
+// captureLogger is a Logger that keeps what it is given.
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func (l *captureLogger) logged() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestCallWithServerTime(t *testing.T) {
+	c, _ := newPair(t, new(Arith), []Option{WithServerTimestamp()})
+	before := time.Now()
+	rsp, serverTime, err := c.CallWithServerTime("Arith.Multiply", Args{2, 3})
+	after := time.Now()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 6 {
+		t.Fatalf("rsp = %v, want 6", rsp)
+	}
+	// Both ends share a clock here, so the stamp falls within the call.
+	if serverTime.Before(before.Add(-time.Millisecond)) || serverTime.After(after.Add(time.Millisecond)) {
+		t.Fatalf("server time %v outside the call [%v, %v]", serverTime, before, after)
+	}
+
+	plain, _ := newPair(t, new(Arith), nil)
+	if _, serverTime, _ = plain.CallWithServerTime("Arith.Multiply", Args{2, 3}); !serverTime.IsZero() {
+		t.Fatalf("server time %v without WithServerTimestamp", serverTime)
+	}
+}
+
+func TestCallCloseRace(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		sc.Register(new(Arith))
+		go sc.Serve()
+		c := NewClient(a, nil)
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Each call either completes or fails with ErrShutdown;
+				// none may hang.
+				if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil && !errors.Is(err, ErrShutdown) {
+					t.Errorf("call racing Close: %v", err)
+				}
+			}()
+		}
+		c.Close()
+		wg.Wait()
+		sc.Close()
+	}
+}
+
+type Nothing int
+
+func (*Nothing) Map(_ int, reply *map[string]int) error {
+	return nil // leaves the reply a nil map
+}
+
+func TestNilResultSlot(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	sc := NewServerConn(b, nil)
+	defer sc.Close()
+	sc.Register(new(Nothing))
+	sc.Register(make(Acker, 1))
+	go sc.Serve()
+	tr := NewConnTransport(a, nil)
+	h := new(codec.MsgpackHandle)
+	for _, call := range []struct {
+		method string
+		arg    interface{}
+	}{{"Nothing.Map", 0}, {"Acker.Ack", Args{}}} {
+		var req []byte
+		codec.NewEncoderBytes(&req, h).Encode([]interface{}{msgpackRPCReq, 1, call.method, []interface{}{call.arg}})
+		if err := tr.WriteMessage(req); err != nil {
+			t.Fatal(err)
+		}
+		rsp, err := tr.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// [1, 1, nil, nil]
+		if want := []byte{0x94, 0x01, 0x01, 0xc0, 0xc0}; !bytes.Equal(rsp, want) {
+			t.Fatalf("%s response = % x, want % x", call.method, rsp, want)
+		}
+	}
+}
+
+func TestCallRightAfterNewClient(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		sc.Register(new(Arith))
+		go sc.Serve()
+		c := NewClient(a, nil)
+		rsp, err := c.Call("Arith.Multiply", Args{i, 2})
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if n, _ := rsp.(int64); n != int64(2*i) {
+			t.Fatalf("call %d: rsp = %v, want %d", i, rsp, 2*i)
+		}
+		c.Close()
+		sc.Close()
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Arith), nil, WithClientID("worker-7"))
+	n, err := c.EncodedSize("Arith.Multiply", Args{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	sent := rec.messages()
+	if len(sent) != 1 || len(sent[0]) != n {
+		t.Fatalf("EncodedSize = %d, sent %d messages %v", n, len(sent), sent)
+	}
+}
+
+// BenchmarkCallAllocs reports the allocations of a round trip, which the
+// pooled encoders keep off the send path.
+func BenchmarkCallAllocs(b *testing.B) {
+	c, _ := newPair(b, new(Arith), nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncodeAllocs compares encoding a request with a pooled encoder
+// against a fresh encoder per message.
+func BenchmarkEncodeAllocs(b *testing.B) {
+	ep := newEndpoint(nil, nil, nil)
+	req := []interface{}{msgpackRPCReq, 1, "Arith.Multiply", []interface{}{Args{2, 3}}}
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ep.marshal(req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var msg []byte
+			if err := codec.NewEncoderBytes(&msg, ep.mpk).Encode(req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
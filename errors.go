@@ -0,0 +1,59 @@
+package endpoint
+
+import (
+	"errors"
+)
+
+var ErrShutdown = errors.New("rpc: endpoint is shut down")
+
+var ErrCanceled = errors.New("rpc: call canceled")
+
+var ErrNoRequest = errors.New("rpc: context does not belong to a request")
+
+var ErrDuplicateService = errors.New("rpc: service already defined")
+
+var ErrDuplicateMethod = errors.New("rpc: method already defined")
+
+var ErrTooManyServices = errors.New("rpc: too many services registered")
+
+var ErrMethodNameTooLong = errors.New("rpc: method name too long")
+
+var ErrHandlerPanic = errors.New("rpc: handler panicked")
+
+var ErrInvalidUTF8 = errors.New("rpc: string is not valid UTF-8")
+
+var ErrBadRequest = errors.New("rpc: bad request")
+
+// ErrFrameTooLarge ends a connection whose peer sent a message over the
+// size set with WithMaxFrameSize.
+var ErrFrameTooLarge = errors.New("rpc: frame too large")
+
+var ErrCallTimeout = errors.New("rpc: call timed out")
+
+// ErrStartTimeout shuts down a Client whose read loop did not start within
+// the time set by WithStartTimeout, or could not start at all.
+var ErrStartTimeout = errors.New("rpc: read loop did not start")
+
+// ErrReadTimeout ends a connection on which nothing arrived for the time
+// set with WithReadTimeout.
+var ErrReadTimeout = errors.New("rpc: read timed out")
+
+// ErrNoFreeMsgID fails a call made while every msgid is taken by a pending
+// call.
+var ErrNoFreeMsgID = errors.New("rpc: no free msgid")
+
+// ErrNoEvent is returned by LongPoll when no event arrived before the
+// deadline. Long poll handlers return it to answer without an event.
+var ErrNoEvent = errors.New("rpc: no event")
+
+// ErrNoConn is returned by every call on a Client or ServerConn that was
+// constructed without a connection.
+var ErrNoConn = errors.New("rpc: no connection")
+
+// ErrConnClosed fails the calls pending when a reconnecting Client loses
+// its connection, and calls made while it reconnects. They may be retried.
+var ErrConnClosed = errors.New("rpc: connection closed")
+
+// ErrPeerClosed ends a connection whose peer closed it on purpose, having
+// announced it with WithGoodbyeNotify.
+var ErrPeerClosed = errors.New("rpc: connection closed by peer")
@@ -0,0 +1,109 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestClosedConnErrorUnwraps(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			sc := NewServerConn(conn, nil)
+			sc.Register(new(Arith))
+			sc.Serve()
+		}
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(conn, nil)
+	defer c.Close()
+	conn.Close()
+	<-c.Done()
+	if _, err = c.Call("Arith.Multiply", Args{2, 3}); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("call error = %v, want one wrapping net.ErrClosed", err)
+	}
+	if !errors.Is(c.Err(), net.ErrClosed) {
+		t.Fatalf("Err() = %v, want one wrapping net.ErrClosed", c.Err())
+	}
+}
+
+type Failer int
+
+func (*Failer) Fail(_ int, _ *int) error {
+	return errors.New("boom")
+}
+
+func TestRemoteError(t *testing.T) {
+	c, _ := newPair(t, new(Failer), nil)
+	_, err := c.Call("Failer.Fail", 0)
+	var re *RemoteError
+	if !errors.As(err, &re) {
+		t.Fatalf("err = %#v, want a *RemoteError", err)
+	}
+	if re.Message != "boom" || re.Method != "Failer.Fail" {
+		t.Fatalf("RemoteError = %+v, want Failer.Fail: boom", re)
+	}
+
+	// Transport failures are not remote errors.
+	c.Close()
+	if _, err = c.Call("Failer.Fail", 0); err == nil || errors.As(err, &re) {
+		t.Fatalf("err after Close = %#v, want a local error", err)
+	}
+}
+
+func TestServerConnErrAfterClientClose(t *testing.T) {
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil)
+	defer sc.Close()
+	go sc.Serve()
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Err() = %v while serving", err)
+	}
+	c := NewClient(a, nil)
+	c.Close()
+	select {
+	case <-sc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the client went away")
+	}
+	if err := sc.Err(); err == nil {
+		t.Fatal("Err() = nil after the client went away")
+	}
+}
+
+func TestUnknownRPCError(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c := NewClient(a, nil)
+	defer c.Close()
+	h := new(codec.MsgpackHandle)
+	go func() {
+		msgid := readRequest(t, codec.NewDecoder(b, h))
+		codec.NewEncoder(b, h).Encode([]interface{}{msgpackRPCRsp, msgid, 42, nil})
+	}()
+	_, err := c.Call("Arith.Multiply", Args{2, 3})
+	var ue *UnknownRPCError
+	if !errors.As(err, &ue) {
+		t.Fatalf("err = %#v, want an *UnknownRPCError", err)
+	}
+	if n, _ := ue.Raw.(int64); n != 42 || ue.Message != "42" || ue.Method != "Arith.Multiply" {
+		t.Fatalf("UnknownRPCError = %+v, want the raw 42", ue)
+	}
+	var re *RemoteError
+	if !errors.As(err, &re) {
+		t.Fatal("UnknownRPCError does not unwrap to a *RemoteError")
+	}
+}
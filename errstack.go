@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+	"errors"
+	"runtime/debug"
+)
+
+// StackTracer is implemented by errors that carry the stack they were
+// created on. With WithErrorStacks, a handler error implementing it is sent
+// with its stack, and errors received with a stack implement it too.
+type StackTracer interface {
+	StackTrace() string
+}
+
+// Keys of the map sent as the response error when it carries a stack.
+const (
+	errKeyMessage = "message"
+	errKeyStack   = "stack"
+)
+
+// WithErrorStacks sends handler errors together with their stack trace,
+// for development. The stack is taken from errors implementing StackTracer
+// and recorded for recovered panics. The response error then becomes a map
+// of message and stack, which peers other than this package may not
+// understand, so it is off by default.
+func WithErrorStacks() Option {
+	return func(ep *endpoint) {
+		ep.errStacks = true
+	}
+}
+
+type stackError struct {
+	err   error
+	stack string
+}
+
+func (e *stackError) Error() string      { return e.err.Error() }
+func (e *stackError) Unwrap() error      { return e.err }
+func (e *stackError) StackTrace() string { return e.stack }
+
+// withStack attaches the current goroutine's stack to err when error stacks
+// are enabled.
+func (ep *endpoint) withStack(err error) error {
+	if !ep.errStacks {
+		return err
+	}
+	return &stackError{err: err, stack: string(debug.Stack())}
+}
+
+// errorValue is what goes in the error element of the response for err.
+func (ep *endpoint) errorValue(err error) interface{} {
+	var st StackTracer
+	if ep.errStacks && errors.As(err, &st) {
+		return map[string]string{errKeyMessage: err.Error(), errKeyStack: st.StackTrace()}
+	}
+	return err.Error()
+}
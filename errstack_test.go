@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type tracedError struct{}
+
+func (tracedError) Error() string      { return "traced" }
+func (tracedError) StackTrace() string { return "main.handler()\n\tfile.go:1" }
+
+type Tracer int
+
+func (*Tracer) Fail(_ int, _ *int) error {
+	return tracedError{}
+}
+
+func TestErrorStacks(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		var opts []Option
+		if enabled {
+			opts = append(opts, WithErrorStacks())
+		}
+		c, sc := newPair(t, new(Panicker), opts)
+		sc.Register(new(Tracer))
+		for method, want := range map[string]string{
+			"Panicker.Boom": "Boom",
+			"Tracer.Fail":   "main.handler()",
+		} {
+			_, err := c.Call(method, 0)
+			if err == nil {
+				t.Fatalf("%s succeeded", method)
+			}
+			var st StackTracer
+			switch hasStack := errors.As(err, &st); {
+			case enabled && !hasStack:
+				t.Errorf("%s with error stacks: %v carries no stack", method, err)
+			case enabled && !strings.Contains(st.StackTrace(), want):
+				t.Errorf("%s stack = %q, want it to mention %q", method, st.StackTrace(), want)
+			case !enabled && hasStack:
+				t.Errorf("%s without error stacks: got stack %q", method, st.StackTrace())
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// ExitCause classifies why a read loop ended.
+type ExitCause int
+
+const (
+	ExitEOF          ExitCause = iota // the peer closed the connection
+	ExitDecodeError                   // a message could not be decoded
+	ExitWriteFailure                  // a write failed, ending the connection
+	ExitIdleTimeout                   // a read deadline on the connection passed
+	ExitShutdown                      // the endpoint was closed locally
+	ExitReadError                     // any other read error
+)
+
+func (c ExitCause) String() string {
+	switch c {
+	case ExitEOF:
+		return "eof"
+	case ExitDecodeError:
+		return "decode error"
+	case ExitWriteFailure:
+		return "write failure"
+	case ExitIdleTimeout:
+		return "idle timeout"
+	case ExitShutdown:
+		return "shutdown"
+	case ExitReadError:
+		return "read error"
+	}
+	return "unknown"
+}
+
+// WithReadLoopExitHook calls hook once the read loop has ended, with the
+// error Reading returns and its cause.
+func WithReadLoopExitHook(hook func(err error, cause ExitCause)) Option {
+	return func(ep *endpoint) {
+		ep.exitHook = hook
+	}
+}
+
+// exitCause classifies err, the reason the endpoint was shut down when
+// its read loop ended. decode is set if the loop stopped on a message it
+// could not decode.
+func (ep *endpoint) exitCause(err error, decode bool) ExitCause {
+	var nerr net.Error
+	switch {
+	case errors.Is(err, ErrShutdown), errors.Is(err, ErrStartTimeout):
+		return ExitShutdown
+	case ep.writeFailed.Load():
+		return ExitWriteFailure
+	case decode, errors.Is(err, ErrFrameTooLarge):
+		return ExitDecodeError
+	case errors.Is(err, ErrPeerClosed), errors.Is(err, io.EOF):
+		return ExitEOF
+	case errors.Is(err, ErrReadTimeout), errors.As(err, &nerr) && nerr.Timeout():
+		return ExitIdleTimeout
+	}
+	return ExitReadError
+}
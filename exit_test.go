@@ -0,0 +1,112 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// brokenWriter is a Transport whose writes fail while reads block until
+// it is closed, like a peer that stopped reading.
+type brokenWriter struct {
+	closed chan struct{}
+}
+
+func (t *brokenWriter) ReadMessage() ([]byte, error) {
+	<-t.closed
+	return nil, net.ErrClosed
+}
+
+func (t *brokenWriter) WriteMessage(msg []byte) error {
+	return errors.New("broken pipe")
+}
+
+func (t *brokenWriter) Close() error {
+	select {
+	case <-t.closed:
+	default:
+		close(t.closed)
+	}
+	return nil
+}
+
+func exitHook() (Option, chan ExitCause) {
+	ch := make(chan ExitCause, 1)
+	return WithReadLoopExitHook(func(err error, cause ExitCause) { ch <- cause }), ch
+}
+
+func expectExit(t *testing.T, ch chan ExitCause, want ExitCause) {
+	t.Helper()
+	select {
+	case cause := <-ch:
+		if cause != want {
+			t.Fatalf("exit cause = %v, want %v", cause, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("exit hook not called, want %v", want)
+	}
+}
+
+func TestExitHookWriteFailure(t *testing.T) {
+	hook, exited := exitHook()
+	c := NewClientTransport(&brokenWriter{closed: make(chan struct{})}, nil, hook)
+	defer c.Close()
+	if _, err := c.Call("Arith.Multiply", Args{1, 2}); err == nil {
+		t.Fatal("call over a broken transport succeeded")
+	}
+	expectExit(t, exited, ExitWriteFailure)
+}
+
+func TestExitHookDecodeError(t *testing.T) {
+	hook, exited := exitHook()
+	a, b := net.Pipe()
+	defer a.Close()
+	sc := NewServerConn(b, nil, hook)
+	go sc.Serve()
+	a.Write([]byte{0x05}) // an int, not an rpc frame
+	expectExit(t, exited, ExitDecodeError)
+}
+
+func TestExitHookEOFAndShutdown(t *testing.T) {
+	hook, exited := exitHook()
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil, hook)
+	go sc.Serve()
+	a.Close()
+	expectExit(t, exited, ExitEOF)
+
+	a, b = net.Pipe()
+	defer a.Close()
+	sc = NewServerConn(b, nil, hook)
+	go sc.Serve()
+	sc.Close()
+	expectExit(t, exited, ExitShutdown)
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	hook, exited := exitHook()
+	a, b := net.Pipe()
+	defer a.Close()
+	sc := NewServerConn(b, nil, hook, WithMaxFrameSize(1024))
+	served := make(chan error, 1)
+	go func() { served <- sc.Serve() }()
+	go func() {
+		// A request whose params claim to be a 2GB bin, followed by as
+		// much filler as the server will read.
+		a.Write([]byte{0x94, 0x00, 0x01, 0xa1, 'm', 0xc6, 0x7f, 0xff, 0xff, 0xff})
+		filler := make([]byte, 4096)
+		for {
+			if _, err := a.Write(filler); err != nil {
+				return
+			}
+		}
+	}()
+	expectExit(t, exited, ExitDecodeError)
+	if err := <-served; !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("Serve = %v, want ErrFrameTooLarge", err)
+	}
+	if _, err := a.Write([]byte{0xc0}); err == nil {
+		t.Fatal("connection still open after an oversized frame")
+	}
+}
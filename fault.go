@@ -0,0 +1,37 @@
+package endpoint
+
+// Phase names a stage of message processing at which a fault can be
+// injected with WithFaultInjector, which only exists in builds with the
+// faultinject tag.
+type Phase int
+
+const (
+	PhaseEncode Phase = iota
+	PhaseWrite
+	PhaseRead
+	PhaseDecode
+	PhaseDispatch
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseEncode:
+		return "encode"
+	case PhaseWrite:
+		return "write"
+	case PhaseRead:
+		return "read"
+	case PhaseDecode:
+		return "decode"
+	case PhaseDispatch:
+		return "dispatch"
+	}
+	return "unknown"
+}
+
+func (ep *endpoint) fault(phase Phase) error {
+	if ep.faults == nil {
+		return nil
+	}
+	return ep.faults(phase)
+}
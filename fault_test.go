@@ -0,0 +1,52 @@
+//go:build faultinject
+
+package endpoint
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFaultInjectorDecode(t *testing.T) {
+	injected := errors.New("injected decode fault")
+	c, _ := newPair(t, new(Arith), nil, WithFaultInjector(func(phase Phase) error {
+		if phase == PhaseDecode {
+			return injected
+		}
+		return nil
+	}))
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); !errors.Is(err, injected) {
+		t.Fatalf("call error = %v, want the injected fault", err)
+	}
+	if c.ep.pendingCount() != 0 {
+		t.Fatal("failed call left a pending entry")
+	}
+}
+
+func TestFaultInjectorEachPhase(t *testing.T) {
+	for _, phase := range []Phase{PhaseEncode, PhaseWrite, PhaseRead, PhaseDecode} {
+		injected := errors.New("injected " + phase.String() + " fault")
+		c, _ := newPair(t, new(Arith), nil, WithFaultInjector(func(p Phase) error {
+			if p == phase {
+				return injected
+			}
+			return nil
+		}))
+		if _, err := c.Call("Arith.Multiply", Args{2, 3}); !errors.Is(err, injected) {
+			t.Errorf("%v: call error = %v, want the injected fault", phase, err)
+		}
+	}
+}
+
+func TestFaultInjectorDispatch(t *testing.T) {
+	injected := errors.New("injected dispatch fault")
+	c, _ := newPair(t, new(Arith), []Option{WithFaultInjector(func(p Phase) error {
+		if p == PhaseDispatch {
+			return injected
+		}
+		return nil
+	})})
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err == nil || err.Error() != injected.Error() {
+		t.Fatalf("call error = %v, want the injected fault", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build faultinject
+
+package endpoint
+
+// WithFaultInjector is for tests only and needs the faultinject build tag.
+// fn is called at every phase of every message; a non-nil error makes that
+// phase fail with it, exactly as if the encoder, transport or handler had
+// returned it.
+func WithFaultInjector(fn func(phase Phase) error) Option {
+	return func(ep *endpoint) {
+		ep.faults = fn
+	}
+}
@@ -0,0 +1,22 @@
+package endpoint
+
+// goodbyeMethod is the reserved notification sent by Close with
+// WithGoodbyeNotify, so the peer can tell an intentional close from a
+// crash.
+const goodbyeMethod = "$goodbye"
+
+// WithGoodbyeNotify makes Close announce itself to the peer before closing
+// the connection. The peer's read loop then ends with ErrPeerClosed rather
+// than a read error, unless it is a Client that redials with WithDialFunc.
+func WithGoodbyeNotify() Option {
+	return func(ep *endpoint) {
+		ep.goodbye = true
+	}
+}
+
+// sayGoodbye sends $goodbye unless the endpoint is already shut down.
+func (ep *endpoint) sayGoodbye() {
+	if ep.goodbye && ep.closedErr() == nil {
+		ep.Notify(goodbyeMethod)
+	}
+}
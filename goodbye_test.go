@@ -0,0 +1,80 @@
+package endpoint
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// closedBy closes the client of a pair with stop and returns the error
+// the server's read loop ended with.
+func closedBy(t *testing.T, stop func(c *Client, conn net.Conn), opts ...Option) error {
+	t.Helper()
+	a, b := net.Pipe()
+	sc := NewServerConn(b, nil)
+	defer sc.Close()
+	go sc.Serve()
+	c := NewClient(a, nil, opts...)
+	stop(c, a)
+	select {
+	case <-sc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("server still up after the client closed")
+	}
+	return sc.Err()
+}
+
+func TestGoodbyeNotify(t *testing.T) {
+	err := closedBy(t, func(c *Client, _ net.Conn) { c.Close() }, WithGoodbyeNotify())
+	if !errors.Is(err, ErrPeerClosed) {
+		t.Fatalf("graceful close: server Err() = %v, want ErrPeerClosed", err)
+	}
+
+	// Without $goodbye, or when the connection just drops, the server
+	// sees a plain EOF.
+	err = closedBy(t, func(c *Client, _ net.Conn) { c.Close() })
+	if errors.Is(err, ErrPeerClosed) || !errors.Is(err, io.EOF) {
+		t.Fatalf("close without goodbye: server Err() = %v, want EOF", err)
+	}
+	err = closedBy(t, func(c *Client, conn net.Conn) {
+		conn.Close()
+		c.Close()
+	}, WithGoodbyeNotify())
+	if errors.Is(err, ErrPeerClosed) || !errors.Is(err, io.EOF) {
+		t.Fatalf("abrupt close: server Err() = %v, want EOF", err)
+	}
+}
+
+func TestGoodbyeThenRedial(t *testing.T) {
+	serve := func(opts ...Option) (net.Conn, *ServerConn) {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil, opts...)
+		sc.Register(new(Arith))
+		go sc.Serve()
+		t.Cleanup(sc.Close)
+		return a, sc
+	}
+	first, sc := serve(WithGoodbyeNotify())
+	dial := func() (net.Conn, error) {
+		conn, _ := serve()
+		return conn, nil
+	}
+	c := NewClient(first, nil, WithDialFunc(dial), WithReconnect(time.Millisecond))
+	defer c.Close()
+	sc.Close()
+
+	var rsp interface{}
+	var err error
+	waitFor(t, "a call over the new connection", func() bool {
+		rsp, err = c.Call("Arith.Multiply", Args{4, 5})
+		return err == nil
+	})
+	if n, _ := rsp.(int64); n != 20 {
+		t.Fatalf("rsp = %v, want 20", rsp)
+	}
+	if c.ep.peerGone.Load() {
+		t.Fatal("the old peer's goodbye outlived the reconnect")
+	}
+}
@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"context"
+	"sync"
+)
+
+// HedgeTracker detects hedged requests: requests with the same method and
+// idempotency key whose handlers run at the same time, typically sent by a
+// client to several connections to cut tail latency. Once one of them
+// returns, the contexts of the others are cancelled so they can stop early.
+// Share a tracker between the ServerConns a client hedges across.
+type HedgeTracker struct {
+	mu     sync.Mutex
+	groups map[string]*hedgeGroup
+}
+
+type hedgeGroup struct {
+	cancels []context.CancelFunc
+}
+
+// NewHedgeTracker returns an empty tracker.
+func NewHedgeTracker() *HedgeTracker {
+	return &HedgeTracker{groups: make(map[string]*hedgeGroup)}
+}
+
+// WithHedgeTracker cancels redundant hedged handlers using t. Requests
+// answered from a DedupCache never run twice and so are never hedged.
+func WithHedgeTracker(t *HedgeTracker) Option {
+	return func(ep *endpoint) {
+		ep.hedges = t
+	}
+}
+
+// join adds a handler running under cancel to the group for key.
+func (t *HedgeTracker) join(key string, cancel context.CancelFunc) (g *hedgeGroup) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if g = t.groups[key]; g == nil {
+		g = new(hedgeGroup)
+		t.groups[key] = g
+	}
+	g.cancels = append(g.cancels, cancel)
+	return
+}
+
+// finish is called when a handler of g returns. The first to return
+// dissolves the group and cancels the others.
+func (t *HedgeTracker) finish(key string, g *hedgeGroup) {
+	t.mu.Lock()
+	if t.groups[key] == g {
+		delete(t.groups, key)
+	}
+	cancels := g.cancels
+	g.cancels = nil
+	t.mu.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Work takes d nanoseconds unless its context is cancelled first.
+type Work struct{ cancelled chan time.Time }
+
+func (w *Work) Do(ctx context.Context, d int64, reply *int) error {
+	select {
+	case <-time.After(time.Duration(d)):
+		return nil
+	case <-ctx.Done():
+		w.cancelled <- time.Now()
+		return ctx.Err()
+	}
+}
+
+func TestHedgedRequestCancelled(t *testing.T) {
+	hedges := NewHedgeTracker()
+	w := &Work{cancelled: make(chan time.Time, 1)}
+	first, _ := newPair(t, w, []Option{WithHedgeTracker(hedges)})
+	second, _ := newPair(t, w, []Option{WithHedgeTracker(hedges)})
+
+	go func() {
+		if _, err := first.CallIdempotent("job-1", "Work.Do", int64(50*time.Millisecond)); err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	if _, err := second.CallIdempotent("job-1", "Work.Do", int64(time.Minute)); err == nil {
+		t.Fatal("the redundant hedge completed")
+	}
+	// The first handler had about 40ms left when the second started.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("second handler stopped after %v, before the first completed", elapsed)
+	}
+	select {
+	case <-w.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("second handler was not cancelled")
+	}
+}
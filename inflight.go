@@ -0,0 +1,55 @@
+package endpoint
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// RequestInfo describes a request whose handler is still executing. It
+// carries enough to replay the request against another endpoint.
+type RequestInfo struct {
+	MsgID         uint32
+	Method        string
+	Params        codec.Raw // params array exactly as received
+	Started       time.Time
+	CorrelationID string // see WithCallCorrelation; empty if none was sent
+}
+
+func (ep *endpoint) trackRequest(msgid uint32, method string, params codec.Raw, md Metadata) {
+	info := &RequestInfo{
+		MsgID:   msgid,
+		Method:  method,
+		Params:  append(codec.Raw(nil), params...),
+		Started: time.Now(),
+	}
+	info.CorrelationID, _ = md.String(mdCorrelationID)
+	ep.inflightmu.Lock()
+	if ep.inflight == nil {
+		ep.inflight = make(map[uint32]*RequestInfo)
+	}
+	ep.inflight[msgid] = info
+	ep.inflightmu.Unlock()
+}
+
+func (ep *endpoint) untrackRequest(msgid uint32) {
+	ep.inflightmu.Lock()
+	delete(ep.inflight, msgid)
+	ep.inflightmu.Unlock()
+}
+
+// InFlightRequests returns a snapshot of the requests currently being
+// handled, ordered by msgid.
+func (ep *endpoint) InFlightRequests() []RequestInfo {
+	ep.inflightmu.Lock()
+	infos := make([]RequestInfo, 0, len(ep.inflight))
+	for _, info := range ep.inflight {
+		cp := *info
+		cp.Params = append(codec.Raw(nil), info.Params...)
+		infos = append(infos, cp)
+	}
+	ep.inflightmu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].MsgID < infos[j].MsgID })
+	return infos
+}
@@ -0,0 +1,44 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Gate holds Wait calls until its channel is closed.
+type Gate chan struct{}
+
+func (g Gate) Wait(args Args, reply *int) error {
+	<-g
+	*reply = args.A
+	return nil
+}
+
+func TestInFlightRequests(t *testing.T) {
+	gate := make(Gate)
+	c, sc := newPair(t, gate, nil)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Gate.Wait", Args{7, 8})
+		done <- err
+	}()
+	waitFor(t, "the handler to start", func() bool { return len(sc.InFlightRequests()) == 1 })
+	info := sc.InFlightRequests()[0]
+	if info.Method != "Gate.Wait" || info.Started.IsZero() {
+		t.Fatalf("info = %+v", info)
+	}
+	var params []Args
+	if err := codec.NewDecoderBytes(info.Params, new(codec.MsgpackHandle)).Decode(&params); err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 1 || params[0] != (Args{7, 8}) {
+		t.Fatalf("params = %+v", params)
+	}
+
+	close(gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the request to finish", func() bool { return len(sc.InFlightRequests()) == 0 })
+}
@@ -0,0 +1,97 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// CallInterceptor wraps an outgoing call. ctx is the call's context, or a
+// background one for calls made without, carrying the metadata sent with
+// the call; it sees the method and params and runs the call with next,
+// which it may skip to fail the call before anything is sent. next must be
+// called at most once, and covers the retries set with WithCallRetry.
+type CallInterceptor func(ctx context.Context, method string, params []interface{}, next func() (interface{}, error)) (interface{}, error)
+
+// HandlerInterceptor wraps the handler of an incoming request or
+// notification. ctx is the context the handler gets, carrying the request
+// metadata and the caller's address; arg is the decoded, validated arg;
+// next runs the handler and returns its error. Returning an error without
+// calling next rejects the request with that error.
+type HandlerInterceptor func(ctx context.Context, method string, arg interface{}, next func() error) error
+
+// WithCallInterceptor adds ic around the calls made through the endpoint:
+// every Call variant except Speculate. Interceptors run in the order they
+// are added, the first outermost.
+func WithCallInterceptor(ic CallInterceptor) Option {
+	return func(ep *endpoint) {
+		ep.callHooks = append(ep.callHooks, ic)
+	}
+}
+
+// WithHandlerInterceptor adds hi around every handler the endpoint runs.
+// Interceptors run in the order they are added, the first outermost.
+func WithHandlerInterceptor(hi HandlerInterceptor) Option {
+	return func(ep *endpoint) {
+		ep.handlerHooks = append(ep.handlerHooks, hi)
+	}
+}
+
+// roundTrip starts req and waits for it with wait, through the call
+// interceptors, retrying it as WithCallRetry allows.
+func (ep *endpoint) roundTrip(ctx context.Context, req *request, method string, params []interface{}, wait func(*request) (interface{}, error)) (interface{}, error) {
+	var cid string
+	if ep.correlate {
+		cid = newCorrelationID()
+		req.meta = req.meta.with(mdCorrelationID, cid)
+	}
+	return ep.intercept(withMetadata(ctx, req.meta), method, params, func() (rsp interface{}, err error) {
+		for retries := ep.retries; ; retries-- {
+			if err = ep.start(req, method, params); err == nil {
+				rsp, err = wait(req)
+			}
+			if retries <= 0 || ep.dial == nil || !errors.Is(err, ErrConnClosed) {
+				return
+			}
+			ep.logger.Printf("rpc: call %s%s failed, retrying: %v", method, correlationNote(cid), err)
+			if err = ep.waitUp(ctx); err != nil {
+				return
+			}
+			req.rsp, req.err, req.size, req.stamp = nil, nil, 0, time.Time{}
+		}
+	})
+}
+
+func (ep *endpoint) intercept(ctx context.Context, method string, params []interface{}, call func() (interface{}, error)) (interface{}, error) {
+	for i := len(ep.callHooks) - 1; i >= 0; i-- {
+		ic, next := ep.callHooks[i], call
+		call = func() (interface{}, error) {
+			return ic(ctx, method, params, next)
+		}
+	}
+	return call()
+}
+
+// runHandler calls the handler f through the handler interceptors and
+// returns its error, including a recovered panic.
+func (ep *endpoint) runHandler(ctx context.Context, method string, f reflect.Value, args []reflect.Value, arg reflect.Value) error {
+	run := func() error {
+		out, err := ep.invoke(f, args)
+		if err == nil && len(out) == 1 && !out[0].IsNil() {
+			err = out[0].Interface().(error)
+		}
+		return err
+	}
+	if len(ep.handlerHooks) == 0 {
+		return run()
+	}
+	v := arg.Interface()
+	for i := len(ep.handlerHooks) - 1; i >= 0; i-- {
+		hi, next := ep.handlerHooks[i], run
+		run = func() error {
+			return hi(ctx, method, v, next)
+		}
+	}
+	return run()
+}
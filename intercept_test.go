@@ -0,0 +1,72 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCallInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(tag string) CallInterceptor {
+		return func(ctx context.Context, method string, params []interface{}, next func() (interface{}, error)) (interface{}, error) {
+			mu.Lock()
+			order = append(order, tag+" "+method)
+			mu.Unlock()
+			return next()
+		}
+	}
+	denied := errors.New("not allowed")
+	deny := func(ctx context.Context, method string, params []interface{}, next func() (interface{}, error)) (interface{}, error) {
+		if method == "Arith.Divide" {
+			return nil, denied
+		}
+		return next()
+	}
+	c, rec := newRecordedPair(t, new(Arith), nil,
+		WithCallInterceptor(record("outer")),
+		WithCallInterceptor(record("inner")),
+		WithCallInterceptor(deny))
+
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call("Arith.Divide", Args{6, 3}); err != denied {
+		t.Fatalf("err = %v, want the interceptor's", err)
+	}
+	want := []string{"outer Arith.Multiply", "inner Arith.Multiply", "outer Arith.Divide", "inner Arith.Divide"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("interceptors ran as %v, want %v", order, want)
+	}
+	if n := len(rec.messages()); n != 1 {
+		t.Fatalf("%d messages sent, want only the allowed call", n)
+	}
+}
+
+func TestHandlerInterceptors(t *testing.T) {
+	var seen []string
+	observe := func(ctx context.Context, method string, arg interface{}, next func() error) error {
+		seen = append(seen, method)
+		return next()
+	}
+	reject := func(ctx context.Context, method string, arg interface{}, next func() error) error {
+		if a, ok := arg.(Args); ok && a.B == 0 {
+			return errors.New("rejected")
+		}
+		return next()
+	}
+	c, _ := newPair(t, new(Arith), []Option{WithHandlerInterceptor(observe), WithHandlerInterceptor(reject)})
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	// The handler would answer "divide by zero".
+	if _, err := c.Call("Arith.Divide", Args{2, 0}); err == nil || err.Error() != "rejected" {
+		t.Fatalf("err = %v, want the interceptor's", err)
+	}
+	if want := []string{"Arith.Multiply", "Arith.Divide"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("outer interceptor saw %v, want %v", seen, want)
+	}
+}
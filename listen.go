@@ -0,0 +1,126 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Server accepts connections and serves each with a ServerConn offering
+// the services registered on the Server.
+type Server struct {
+	mpk  *codec.MsgpackHandle
+	opts []Option
+	reg  *endpoint // holds the registered services only
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*ServerConn]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server whose connections use handle, a nil handle
+// meaning a default MsgpackHandle, and are each set up with opts.
+func NewServer(handle *codec.MsgpackHandle, opts ...Option) *Server {
+	// handle is copied once here and each connection gets a copy of that,
+	// so none of them ever copies a handle another one is using.
+	handle = ownHandle(handle)
+	return &Server{
+		mpk:       handle,
+		opts:      opts,
+		reg:       newEndpoint(nil, nil, ownHandle(handle), opts...),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*ServerConn]struct{}),
+	}
+}
+
+// Register publishes the methods of svc on every connection accepted from
+// now on; see ServerConn.Register.
+func (s *Server) Register(svc interface{}) (err error) {
+	return s.reg.Register(svc)
+}
+
+// RegisterName is Register using name instead of svc's type name.
+func (s *Server) RegisterName(svc interface{}, name string) (err error) {
+	return s.reg.RegisterName(svc, name)
+}
+
+// Serve accepts connections from l and serves each on its own goroutine
+// until l fails or the Server is closed, which returns ErrShutdown. l is
+// closed on return.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrShutdown
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrShutdown
+			}
+			return err
+		}
+		sc := NewServerConn(conn, s.mpk, s.opts...)
+		sc.ep.shareServices(s.reg)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			sc.Close()
+			return ErrShutdown
+		}
+		s.conns[sc] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(sc)
+	}
+}
+
+func (s *Server) serveConn(sc *ServerConn) {
+	sc.Serve()
+	sc.Close()
+	s.mu.Lock()
+	delete(s.conns, sc)
+	s.mu.Unlock()
+}
+
+// Close stops every Serve and closes the connections they accepted.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	listeners, conns := s.listeners, s.conns
+	s.listeners = make(map[net.Listener]struct{})
+	s.conns = make(map[*ServerConn]struct{})
+	s.mu.Unlock()
+	for l := range listeners {
+		l.Close()
+	}
+	for sc := range conns {
+		sc.Close()
+	}
+}
+
+// shareServices makes the services registered on from available on ep.
+func (ep *endpoint) shareServices(from *endpoint) {
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	for name, svc := range from.serviceMap {
+		ep.serviceMap[name] = svc
+	}
+}
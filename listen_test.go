@@ -0,0 +1,98 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(nil)
+	if err := s.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	var clients []*Client
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		c, err := DialContext(context.Background(), "tcp", l.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				rsp, err := c.Call("Arith.Multiply", Args{i, j})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n, _ := rsp.(int64); n != int64(i*j) {
+					t.Errorf("client %d: %d*%d = %v", i, i, j, rsp)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s.Close()
+	if err := <-served; !errors.Is(err, ErrShutdown) {
+		t.Fatalf("Serve = %v, want ErrShutdown", err)
+	}
+	for i, c := range clients {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("client %d still connected after Close", i)
+		}
+	}
+}
+
+func TestSharedHandle(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpk := new(codec.MsgpackHandle)
+	s := NewServer(mpk, WithCanonicalEncoding())
+	s.Register(new(Arith))
+	go s.Serve(l)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		c, err := DialContext(context.Background(), "tcp", l.Addr().String(), mpk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := c.Call("Arith.Multiply", Args{i, j}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if mpk.TypeInfos != nil || mpk.ReaderBufferSize != 0 || mpk.Canonical {
+		t.Fatalf("shared handle changed: %+v", mpk)
+	}
+}
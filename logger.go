@@ -0,0 +1,26 @@
+package endpoint
+
+import (
+	"log"
+)
+
+// Logger receives the diagnostics an endpoint reports, such as methods
+// skipped by Register and failed notifications.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// stdLogger is the default Logger, writing to the standard logger.
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// WithLogger sends the endpoint's diagnostics to l instead of the standard
+// logger.
+func WithLogger(l Logger) Option {
+	return func(ep *endpoint) {
+		ep.logger = l
+	}
+}
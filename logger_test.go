@@ -0,0 +1,34 @@
+package endpoint
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+type Secret int
+
+func (*Secret) Reveal(_ int, reply *item) error { return nil }
+
+func (*Secret) Count(_ int, reply *int) error { return nil }
+
+func TestWithLogger(t *testing.T) {
+	var std bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+
+	captured := new(captureLogger)
+	sc := NewServerConn(nil, nil, WithLogger(captured))
+	if err := sc.Register(new(Secret)); err != nil {
+		t.Fatal(err)
+	}
+	lines := captured.logged()
+	if len(lines) != 1 || !strings.Contains(lines[0], "Reveal reply type not exported") {
+		t.Fatalf("logged %q, want the reason Reveal was skipped", lines)
+	}
+	if std.Len() != 0 {
+		t.Fatalf("standard logger got %q", std.String())
+	}
+}
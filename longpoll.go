@@ -0,0 +1,52 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// mdPollTimeout carries the nanoseconds a long poll may be held by the
+// server.
+const mdPollTimeout = "poll_timeout"
+
+// LongPoll is a call the server may hold until it has an event to report.
+// The server learns how long it may hold the call from ctx's deadline; its
+// handler waits on its context and returns ErrNoEvent, or just the
+// context's error, if nothing happens in time. LongPoll then returns
+// ErrNoEvent, as it does when ctx's deadline passes first. Cancelling ctx
+// returns ctx.Err().
+func (ep *endpoint) LongPoll(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	req := new(request)
+	if dl, ok := ctx.Deadline(); ok {
+		req.meta = Metadata{mdPollTimeout: int64(time.Until(dl))}
+	}
+	wait := func(req *request) (interface{}, error) {
+		return ep.waitContext(ctx, req)
+	}
+	rsp, err = ep.roundTrip(ctx, req, method, params, wait)
+	var rerr *RemoteError
+	if err == context.DeadlineExceeded || (errors.As(err, &rerr) && rerr.Message == ErrNoEvent.Error()) {
+		rsp, err = nil, ErrNoEvent
+	}
+	return
+}
+
+// pollContext bounds the handler of a long poll by the time the caller is
+// willing to wait.
+func pollContext(ctx context.Context, md Metadata) (context.Context, context.CancelFunc, bool) {
+	d, ok := md.Int64(mdPollTimeout)
+	if !ok {
+		return ctx, func() {}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d))
+	return ctx, cancel, true
+}
+
+// pollResult turns a long poll handler's expired context into ErrNoEvent.
+func pollResult(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrNoEvent
+	}
+	return err
+}
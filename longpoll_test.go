@@ -0,0 +1,57 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type Events struct{ ch chan int }
+
+func (e *Events) Next(ctx context.Context, _ int, reply *int) error {
+	select {
+	case *reply = <-e.ch:
+		return nil
+	case <-ctx.Done():
+		return ErrNoEvent
+	}
+}
+
+func TestLongPollReleasedByEvent(t *testing.T) {
+	ev := &Events{ch: make(chan int)}
+	c, _ := newPair(t, ev, nil)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ev.ch <- 7
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rsp, err := c.LongPoll(ctx, "Events.Next", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 7 {
+		t.Fatalf("rsp = %v, want 7", rsp)
+	}
+}
+
+func TestLongPollNoEvent(t *testing.T) {
+	c, _ := newPair(t, &Events{ch: make(chan int)}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.LongPoll(ctx, "Events.Next", 0); err != ErrNoEvent {
+		t.Fatalf("err = %v, want ErrNoEvent", err)
+	}
+}
+
+func TestPollContextLongTimeout(t *testing.T) {
+	// An hour in nanoseconds does not fit 32 bits.
+	for _, v := range []interface{}{int64(time.Hour), uint64(time.Hour)} {
+		ctx, cancel, ok := pollContext(context.Background(), Metadata{mdPollTimeout: v})
+		dl, _ := ctx.Deadline()
+		cancel()
+		if !ok || time.Until(dl) < 59*time.Minute {
+			t.Fatalf("%T timeout: deadline in %v, want about an hour", v, time.Until(dl))
+		}
+	}
+}
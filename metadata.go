@@ -0,0 +1,140 @@
+package endpoint
+
+import (
+	"context"
+	"math"
+)
+
+// Metadata travels with a request as an optional fifth element of the
+// request array, after params. It is only sent when non-empty, so requests
+// without metadata stay plain msgpack-rpc. Handlers see the metadata of the
+// request they serve through their context.
+type Metadata map[string]interface{}
+
+const (
+	mdClientID     = "client_id"
+	mdParamVersion = "param_version"
+)
+
+type metadataKey struct{}
+
+func withMetadata(ctx context.Context, md Metadata) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the metadata sent with the request being
+// handled under ctx.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// String returns the string value of key. Strings may arrive as raw bytes
+// depending on the peer's handle, so both forms are accepted.
+func (md Metadata) String(key string) (s string, ok bool) {
+	switch v := md[key].(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return
+}
+
+// Int returns the integer value of key. msgpack integers decode as int64
+// or uint64 depending on their encoding, so both are accepted.
+func (md Metadata) Int(key string) (n int, ok bool) {
+	switch v := md[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case uint64:
+		return int(v), true
+	}
+	return
+}
+
+// Int64 is Int for values that may not fit an int, such as durations on
+// 32-bit platforms. A uint64 too large for an int64 is not ok.
+func (md Metadata) Int64(key string) (n int64, ok bool) {
+	switch v := md[key].(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return
+		}
+		return int64(v), true
+	}
+	return
+}
+
+// WithClientID sends id with every request, so servers can attribute calls
+// to a client instance across reconnects.
+func WithClientID(id string) Option {
+	return func(ep *endpoint) {
+		ep.setMetadata(mdClientID, id)
+	}
+}
+
+// ClientIDFromContext returns the client id the caller configured with
+// WithClientID.
+func ClientIDFromContext(ctx context.Context) (id string, ok bool) {
+	return MetadataFromContext(ctx).String(mdClientID)
+}
+
+// WithParamVersion advertises version v of the params this client sends,
+// so handlers can keep decoding params from older clients as an API
+// evolves.
+func WithParamVersion(v int) Option {
+	return func(ep *endpoint) {
+		ep.setMetadata(mdParamVersion, v)
+	}
+}
+
+// ParamVersionFromContext returns the param version the caller configured
+// with WithParamVersion; ok is false if it sent none.
+func ParamVersionFromContext(ctx context.Context) (v int, ok bool) {
+	return MetadataFromContext(ctx).Int(mdParamVersion)
+}
+
+func (ep *endpoint) setMetadata(key string, v interface{}) {
+	if ep.meta == nil {
+		ep.meta = make(Metadata)
+	}
+	ep.meta[key] = v
+}
+
+// with returns a copy of md with key set to v.
+func (md Metadata) with(key string, v interface{}) Metadata {
+	out := make(Metadata, len(md)+1)
+	for k, x := range md {
+		out[k] = x
+	}
+	out[key] = v
+	return out
+}
+
+// requestMetadata merges the endpoint's metadata with req's own; req wins.
+func (ep *endpoint) requestMetadata(req *request) Metadata {
+	if len(req.meta) == 0 {
+		return ep.meta
+	}
+	if len(ep.meta) == 0 {
+		return req.meta
+	}
+	md := make(Metadata, len(ep.meta)+len(req.meta))
+	for k, v := range ep.meta {
+		md[k] = v
+	}
+	for k, v := range req.meta {
+		md[k] = v
+	}
+	return md
+}
@@ -0,0 +1,81 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+type Whoami int
+
+func (*Whoami) ClientID(ctx context.Context, _ int, reply *string) error {
+	*reply, _ = ClientIDFromContext(ctx)
+	return nil
+}
+
+func TestClientID(t *testing.T) {
+	c, _ := newPair(t, new(Whoami), nil, WithClientID("worker-7"))
+	rsp, err := c.Call("Whoami.ClientID", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := string(rsp.([]byte)); id != "worker-7" {
+		t.Fatalf("handler saw client id %q, want %q", id, "worker-7")
+	}
+
+	anon, _ := newPair(t, new(Whoami), nil)
+	if rsp, err = anon.Call("Whoami.ClientID", 0); err != nil {
+		t.Fatal(err)
+	}
+	if id := string(rsp.([]byte)); id != "" {
+		t.Fatalf("handler saw client id %q without WithClientID", id)
+	}
+}
+
+type Name struct {
+	First, Last string
+}
+
+type Greeter int
+
+// Greet takes a plain name in version 1 of its params and a Name from
+// version 2 on.
+func (*Greeter) Greet(ctx context.Context, raw codec.Raw, reply *string) error {
+	h := new(codec.MsgpackHandle)
+	h.RawToString = true
+	if v, _ := ParamVersionFromContext(ctx); v >= 2 {
+		var n Name
+		if err := codec.NewDecoderBytes(raw, h).Decode(&n); err != nil {
+			return err
+		}
+		*reply = "hello " + n.First + " " + n.Last
+		return nil
+	}
+	var name string
+	if err := codec.NewDecoderBytes(raw, h).Decode(&name); err != nil {
+		return err
+	}
+	*reply = "hello " + name
+	return nil
+}
+
+func TestParamVersion(t *testing.T) {
+	for _, tc := range []struct {
+		opts  []Option
+		param interface{}
+	}{
+		{nil, "Ada Lovelace"},
+		{[]Option{WithParamVersion(1)}, "Ada Lovelace"},
+		{[]Option{WithParamVersion(2)}, Name{"Ada", "Lovelace"}},
+	} {
+		c, _ := newPair(t, new(Greeter), nil, tc.opts...)
+		rsp, err := c.Call("Greeter.Greet", tc.param)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(rsp.([]byte)); s != "hello Ada Lovelace" {
+			t.Fatalf("rsp = %q for params %v", s, tc.param)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"github.com/ugorji/go/codec"
+)
+
+// MigrateTo hands the connection over to successor: the client is told the
+// server is draining, and every request arriving from now on is forwarded
+// to successor with its response relayed back, until this connection
+// closes. Requests already running finish here.
+func (sc *ServerConn) MigrateTo(successor *Client) error {
+	sc.ep.successor.Store(successor)
+	return sc.Drain()
+}
+
+// forward relays a request to succ and answers msgid with its outcome.
+// For a notification, msgid is ignored and no answer is sent. params and
+// meta go out as they arrived, so the successor sees the same arguments,
+// metadata and signature the client sent.
+func (ep *endpoint) forward(succ *Client, notify bool, msgid uint32, method string, params, meta codec.Raw) {
+	if notify {
+		if err := succ.ep.relay(nil, method, params, meta); err != nil {
+			ep.logger.Printf("rpc: forwarding notification %s: %v", method, err)
+		}
+		return
+	}
+	req := new(request)
+	if err := succ.ep.relay(req, method, params, meta); err != nil {
+		ep.reply(method, msgid, err.Error(), nil)
+		return
+	}
+	rsp, err := succ.ep.await(req)
+	if err != nil {
+		ep.reply(method, msgid, err.Error(), nil)
+		return
+	}
+	ep.reply(method, msgid, nil, rsp)
+}
+
+// relay sends method with params and meta already encoded, as a call
+// pending on req, or as a notification if req is nil. meta may be nil.
+func (ep *endpoint) relay(req *request, method string, params, meta codec.Raw) (err error) {
+	reqobj := []interface{}{msgpackRPCNotify, method, params}
+	if req != nil {
+		ep.replies.acquire()
+		req.done = make(chan int)
+		req.method = method
+		if err = ep.addPending(req); err != nil {
+			return
+		}
+		reqobj = []interface{}{msgpackRPCReq, req.msgid, method, params}
+	}
+	if meta != nil {
+		reqobj = append(reqobj, meta)
+	}
+	msg, err := ep.marshal(reqobj)
+	if err == nil {
+		ep.capture(method, msg)
+		err = ep.write(msg)
+	}
+	if err != nil && req != nil {
+		ep.takePending(req.msgid)
+	}
+	return
+}
@@ -0,0 +1,166 @@
+package endpoint
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+)
+
+// WithOmitEmpty leaves zero-valued struct fields out of everything the
+// endpoint sends, as if every field were tagged omitempty. Fields tagged
+// `codec:",omitempty"` (or msgpack or json) are omitted with or without
+// this option. Structs are sent as maps of their non-zero fields; the peer
+// decodes a missing field as its zero value. Structs tagged toarray and
+// types that encode themselves, such as time.Time, are sent unchanged.
+func WithOmitEmpty() Option {
+	return func(ep *endpoint) {
+		ep.omitEmpty = true
+	}
+}
+
+var (
+	typeOfSelfer          = reflect.TypeOf((*codec.Selfer)(nil)).Elem()
+	typeOfBinaryMarshaler = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	typeOfTextMarshaler   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	typeOfJSONMarshaler   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// encodesItself reports whether values of t are encoded by their own
+// methods rather than field by field.
+func encodesItself(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	for _, it := range []reflect.Type{typeOfSelfer, typeOfBinaryMarshaler, typeOfTextMarshaler, typeOfJSONMarshaler} {
+		if t.Implements(it) || pt.Implements(it) {
+			return true
+		}
+	}
+	return false
+}
+
+// omitEmptyValue returns v with every struct reachable from it replaced by
+// a map of its non-zero fields.
+func omitEmptyValue(v interface{}) interface{} {
+	return omitEmptyRV(reflect.ValueOf(v), 0)
+}
+
+func omitEmptyRV(rv reflect.Value, depth int) interface{} {
+	if !rv.IsValid() {
+		return nil
+	}
+	if depth > 64 || !hasStructs(rv.Type(), nil) {
+		return rv.Interface()
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return rv.Interface()
+		}
+		return omitEmptyRV(rv.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return rv.Interface()
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = omitEmptyRV(rv.Index(i), depth+1)
+		}
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv.Interface()
+		}
+		out := make(map[interface{}]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[iter.Key().Interface()] = omitEmptyRV(iter.Value(), depth+1)
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]interface{})
+		omitEmptyFields(rv, out, depth)
+		return out
+	}
+	return rv.Interface()
+}
+
+// omitEmptyFields adds the non-zero exported fields of the struct rv to
+// out under their encoded names. Untagged embedded structs are flattened,
+// as the codec does.
+func omitEmptyFields(rv reflect.Value, out map[string]interface{}, depth int) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, skip := fieldName(f)
+		if skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && !encodesItself(fv.Type()) {
+				omitEmptyFields(fv, out, depth+1)
+				continue
+			}
+		}
+		if f.PkgPath != "" || fv.IsZero() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out[name] = omitEmptyRV(fv, depth+1)
+	}
+}
+
+// fieldName returns the name f is encoded under, empty for the field's own
+// name, and whether it is not encoded at all.
+func fieldName(f reflect.StructField) (name string, skip bool) {
+	if f.Name == "_struct" {
+		return "", true
+	}
+	for _, key := range structTagKeys {
+		if tag := f.Tag.Get(key); tag != "" {
+			if tag == "-" {
+				return "", true
+			}
+			name, _, _ = strings.Cut(tag, ",")
+			return name, false
+		}
+	}
+	return "", false
+}
+
+// hasStructs reports whether values of t may contain a struct that
+// omitEmptyValue rewrites, so values without any are left alone.
+func hasStructs(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		return hasStructs(t.Elem(), seen)
+	case reflect.Map:
+		if seen == nil {
+			seen = make(map[reflect.Type]bool)
+		}
+		seen[t] = true
+		return hasStructs(t.Elem(), seen)
+	case reflect.Struct:
+		return !encodesItself(t) && !isToArrayType(t)
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+type Inner struct{ X int }
+
+type Outer struct {
+	A    int
+	B    string `codec:"bee"`
+	C    *Inner
+	D    []Inner
+	T    time.Time
+	Skip int `codec:"-"`
+	Inner
+}
+
+func TestOmitEmptyOnWire(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil, WithOmitEmpty())
+	msg, err := ep.encode("", []interface{}{1, Outer{A: 1, D: []Inner{{}, {X: 2}}, Skip: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bee", "Skip", "\xa1T", "\xa1C"} {
+		if bytes.Contains(msg, []byte(name)) {
+			t.Errorf("empty field %q on the wire: %q", name, msg)
+		}
+	}
+	var parts []codec.Raw
+	if err = codec.NewDecoderBytes(msg, ep.mpk).Decode(&parts); err != nil {
+		t.Fatal(err)
+	}
+	var o Outer
+	if err = codec.NewDecoderBytes(parts[1], ep.mpk).Decode(&o); err != nil {
+		t.Fatal(err)
+	}
+	if o.A != 1 || o.B != "" || len(o.D) != 2 || o.D[1].X != 2 {
+		t.Fatalf("decoded %+v", o)
+	}
+}
+
+func TestEncodedSizeWithOmitEmpty(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Arith), nil, WithOmitEmpty())
+	n, err := c.EncodedSize("Arith.Multiply", Args{A: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Call("Arith.Multiply", Args{A: 3}); err != nil {
+		t.Fatal(err)
+	}
+	sent := rec.messages()
+	if len(sent) != 1 || len(sent[0]) != n {
+		t.Fatalf("EncodedSize = %d, sent %d messages %v", n, len(sent), sent)
+	}
+}
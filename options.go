@@ -0,0 +1,200 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"net"
+	"runtime"
+	"time"
+)
+
+// Option configures an endpoint when a Client or ServerConn is constructed.
+type Option func(ep *endpoint)
+
+// WithWorkerPool runs incoming requests on the shared pool p instead of a
+// goroutine per request. The connection may queue at most budget requests
+// in the pool; once its bucket is full the read loop waits for it to drain.
+func WithWorkerPool(p *WorkerPool, budget int) Option {
+	return func(ep *endpoint) {
+		ep.workq = p.queue(budget)
+	}
+}
+
+// WithStringMapKeys converts the keys of every map in a Call's reply to
+// strings, for interop with peers that treat maps like JSON objects.
+func WithStringMapKeys() Option {
+	return func(ep *endpoint) {
+		ep.stringKeys = true
+	}
+}
+
+// WithMaxServices limits the number of services that may be registered on
+// the endpoint; further registrations fail with ErrTooManyServices.
+func WithMaxServices(n int) Option {
+	return func(ep *endpoint) {
+		ep.maxServices = n
+	}
+}
+
+// WithServerTimestamp appends the local wall-clock time to every response
+// sent, for clock-skew diagnostics. Peers read it with CallWithServerTime;
+// standard msgpack-rpc peers may reject the extra element.
+func WithServerTimestamp() Option {
+	return func(ep *endpoint) {
+		ep.stamp = true
+	}
+}
+
+// WithPauseBuffer sets how many requests are held while the endpoint is
+// paused before it stops reading from the connection.
+func WithPauseBuffer(n int) Option {
+	return func(ep *endpoint) {
+		ep.gate.limit = n
+	}
+}
+
+// WithDuplicateResponseHook calls fn with the msgid of any response that
+// arrives when no call is waiting on it, e.g. a second response to the same
+// request. Such responses are always dropped.
+func WithDuplicateResponseHook(fn func(msgid uint32)) Option {
+	return func(ep *endpoint) {
+		ep.dupHook = fn
+	}
+}
+
+// WithCanonicalEncoding makes encoding deterministic by writing map keys
+// in sorted order, so equal values always produce identical bytes. It sets
+// Canonical on the endpoint's own copy of the MsgpackHandle.
+func WithCanonicalEncoding() Option {
+	return func(ep *endpoint) {
+		ep.mpk.Canonical = true
+	}
+}
+
+// WithMaxMethodNameLen rejects incoming requests and notifications whose
+// method name is longer than n bytes. The length is checked from the
+// frame's headers, before the name is decoded.
+func WithMaxMethodNameLen(n int) Option {
+	return func(ep *endpoint) {
+		ep.maxMethodLen = n
+	}
+}
+
+// WithMaxFrameSize ends the connection with ErrFrameTooLarge when the peer
+// sends a message larger than n bytes. Over a net.Conn no more than n bytes
+// of a message are ever read, whatever lengths its headers claim.
+func WithMaxFrameSize(n int) Option {
+	return func(ep *endpoint) {
+		ep.maxFrame = n
+	}
+}
+
+// WithTCPReadBuffer sets the socket receive buffer size when the connection
+// is a *net.TCPConn, or a *tls.Conn over one, including connections made by
+// a reconnecting Client. It has no effect on other connections.
+func WithTCPReadBuffer(bytes int) Option {
+	return func(ep *endpoint) {
+		ep.tcpReadBuf = bytes
+	}
+}
+
+// WithTCPWriteBuffer is WithTCPReadBuffer for the socket send buffer.
+func WithTCPWriteBuffer(bytes int) Option {
+	return func(ep *endpoint) {
+		ep.tcpWriteBuf = bytes
+	}
+}
+
+// tcpConn returns the *net.TCPConn under conn, if there is one.
+func tcpConn(conn net.Conn) *net.TCPConn {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	tc, _ := conn.(*net.TCPConn)
+	return tc
+}
+
+// tuneConn applies the socket buffer sizes to conn. Failures are logged;
+// the connection is still usable with the system's sizes.
+func (ep *endpoint) tuneConn(conn net.Conn) {
+	tc := tcpConn(conn)
+	if tc == nil {
+		return
+	}
+	if ep.tcpReadBuf > 0 {
+		if err := tc.SetReadBuffer(ep.tcpReadBuf); err != nil {
+			ep.logger.Printf("rpc: set read buffer: %v", err)
+		}
+	}
+	if ep.tcpWriteBuf > 0 {
+		if err := tc.SetWriteBuffer(ep.tcpWriteBuf); err != nil {
+			ep.logger.Printf("rpc: set write buffer: %v", err)
+		}
+	}
+}
+
+// WithStringValidation refuses to send strings that are not valid UTF-8:
+// a call whose params contain one fails with ErrInvalidUTF8, and a reply
+// containing one is replaced by an ErrInvalidUTF8 error response.
+func WithStringValidation() Option {
+	return func(ep *endpoint) {
+		ep.checkUTF8 = true
+	}
+}
+
+// WithUnknownResponseLogging logs responses whose msgid matches no pending
+// call, such as replies to calls that were cancelled or a buggy peer
+// answering a notification. They are dropped either way.
+func WithUnknownResponseLogging() Option {
+	return func(ep *endpoint) {
+		ep.logUnknown = true
+	}
+}
+
+// WithCallTimeout fails calls made without a context with ErrCallTimeout
+// when no reply arrives within d; the pending call is removed and a late
+// reply dropped. Zero, the default, means no timeout. CallContext is
+// bounded by its context instead.
+func WithCallTimeout(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.callTimeout = d
+	}
+}
+
+// WithStartTimeout bounds how long NewClient waits for the read loop to
+// start. If it has not started within d, or the connection is already
+// closed, the Client is shut down with ErrStartTimeout, which every call and
+// Err then report.
+func WithStartTimeout(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.startTimeout = d
+	}
+}
+
+// WithReadTimeout ends the connection with ErrReadTimeout when no message
+// arrives from the peer for d, failing the pending calls, so a dead peer
+// is noticed. The peer must then send something at least every d, even
+// when idle. It needs a net.Conn.
+func WithReadTimeout(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.readTimeout = d
+	}
+}
+
+// WithWriteTimeout fails a write that does not complete within d, as on a
+// peer that stopped reading. The failed write ends the connection like any
+// other. It needs a net.Conn.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.writeTimeout = d
+	}
+}
+
+// WithConcurrentReplyDecode decodes responses on up to GOMAXPROCS
+// goroutines instead of on the read loop, which helps when many large
+// replies to pipelined calls arrive back to back. Replies may then be
+// delivered out of arrival order.
+func WithConcurrentReplyDecode() Option {
+	return func(ep *endpoint) {
+		ep.decodeSem = make(chan struct{}, runtime.GOMAXPROCS(0))
+	}
+}
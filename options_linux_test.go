@@ -0,0 +1,132 @@
+package endpoint
+
+import (
+	"crypto/tls"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// sockopt reads an integer SOL_SOCKET option of conn.
+func sockopt(t *testing.T, conn net.Conn, opt int) (v int) {
+	t.Helper()
+	raw, err := tcpConn(conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serr error
+	if err = raw.Control(func(fd uintptr) {
+		v, serr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	return
+}
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T, l net.Listener) (client, server net.Conn) {
+	t.Helper()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		accepted <- conn
+	}()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return
+}
+
+func TestTCPBufferOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, _ := tcpPair(t, l)
+	c := NewClient(a, nil, WithTCPReadBuffer(8192), WithTCPWriteBuffer(16384))
+	defer c.Close()
+	// Linux reports twice the size set, to account for its bookkeeping.
+	if got := sockopt(t, a, syscall.SO_RCVBUF); got != 2*8192 {
+		t.Errorf("SO_RCVBUF = %d, want %d", got, 2*8192)
+	}
+	if got := sockopt(t, a, syscall.SO_SNDBUF); got != 2*16384 {
+		t.Errorf("SO_SNDBUF = %d, want %d", got, 2*16384)
+	}
+}
+
+func TestTCPBufferOptionsThroughTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, _ := tcpPair(t, l)
+	tc := tls.Client(a, &tls.Config{InsecureSkipVerify: true})
+	if tcpConn(tc) != a {
+		t.Fatal("tcpConn did not unwrap the TLS connection")
+	}
+	ep := newEndpoint(nil, nil, nil, WithTCPReadBuffer(8192))
+	ep.tuneConn(tc)
+	if got := sockopt(t, a, syscall.SO_RCVBUF); got != 2*8192 {
+		t.Errorf("SO_RCVBUF = %d, want %d", got, 2*8192)
+	}
+}
+
+func TestTCPBufferOptionsAfterReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dialed := make(chan net.Conn, 2)
+	dial := func() (net.Conn, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			dialed <- conn
+		}
+		return conn, err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			sc := NewServerConn(conn, nil)
+			sc.Register(new(Arith))
+			go sc.Serve()
+		}
+	}()
+	conn, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-dialed
+	c := NewClient(conn, nil, WithDialFunc(dial), WithReconnect(0), WithTCPReadBuffer(8192))
+	defer c.Close()
+	conn.Close() // force a reconnect
+	var next net.Conn
+	select {
+	case next = <-dialed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not redial")
+	}
+	waitFor(t, "reconnect", func() bool {
+		_, err := c.Call("Arith.Multiply", Args{2, 3})
+		return err == nil
+	})
+	if got := sockopt(t, next, syscall.SO_RCVBUF); got != 2*8192 {
+		t.Errorf("SO_RCVBUF after reconnect = %d, want %d", got, 2*8192)
+	}
+}
@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCanonicalEncoding(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil, WithCanonicalEncoding())
+	m := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		m[fmt.Sprint("key", i)] = i
+	}
+	encode := func(v interface{}) []byte {
+		t.Helper()
+		msg, err := ep.marshal([]interface{}{msgpackRPCNotify, "M.N", []interface{}{v}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	first := encode(m)
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(encode(m), first) {
+			t.Fatal("the same map encoded to different bytes")
+		}
+	}
+	m["key0"] = -1
+	if bytes.Equal(encode(m), first) {
+		t.Fatal("different maps encoded to the same bytes")
+	}
+}
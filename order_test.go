@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// sentMethods returns the method of each message the recorder saw.
+func sentMethods(t *testing.T, rec *recorder) (methods []string) {
+	t.Helper()
+	h := new(codec.MsgpackHandle)
+	for _, msg := range rec.messages() {
+		var frame []interface{}
+		if err := codec.NewDecoderBytes(msg, h).Decode(&frame); err != nil {
+			t.Fatal(err)
+		}
+		i := 1 // [type, method, params]
+		if frame[0] == int64(msgpackRPCReq) {
+			i = 2 // [type, msgid, method, params, ...]
+		}
+		methods = append(methods, string(frame[i].([]byte)))
+	}
+	return
+}
+
+func TestNotifyBeforeCall(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Arith), nil)
+	if err := c.Notify("Session.Setup", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if m := sentMethods(t, rec); len(m) != 2 || m[0] != "Session.Setup" || m[1] != "Arith.Multiply" {
+		t.Fatalf("sent %v, want the notification then the call", m)
+	}
+}
+
+func TestNotifyThenCallAtomic(t *testing.T) {
+	c, rec := newRecordedPair(t, new(Arith), nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				c.Notify("Noise.Make", j)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := c.NotifyThenCall("Session.Setup", []interface{}{i}, "Arith.Multiply", Args{i, 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	m := sentMethods(t, rec)
+	for i, method := range m {
+		if method == "Session.Setup" && (i+1 == len(m) || m[i+1] != "Arith.Multiply") {
+			t.Fatalf("message %d after the setup notification is %v, want the call", i+1, m[i+1:])
+		}
+	}
+}
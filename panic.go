@@ -0,0 +1,50 @@
+package endpoint
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// PanicPolicy decides what happens when a handler panics.
+type PanicPolicy int
+
+const (
+	// PanicRecover answers the request with an error wrapping
+	// ErrHandlerPanic and keeps the connection open. It is the default.
+	PanicRecover PanicPolicy = iota
+	// PanicCloseConn recovers and closes the connection, failing fast.
+	PanicCloseConn
+	// PanicPropagate does not recover. Handlers run on goroutines of
+	// their own, where nothing can recover the panic, so it kills the
+	// whole process with every other connection in it, not only the one
+	// the request came in on.
+	PanicPropagate
+)
+
+// WithPanicPolicy sets what happens when a handler panics, PanicRecover
+// unless set.
+func WithPanicPolicy(p PanicPolicy) Option {
+	return func(ep *endpoint) {
+		ep.panicPolicy = p
+	}
+}
+
+// invoke calls a handler, applying the panic policy. A recovered panic is
+// returned as err.
+func (ep *endpoint) invoke(f reflect.Value, args []reflect.Value) (out []reflect.Value, err error) {
+	if ep.panicPolicy == PanicPropagate {
+		out = f.Call(args)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ep.withStack(fmt.Errorf("%w: %v", ErrHandlerPanic, r))
+			if ep.panicPolicy == PanicCloseConn {
+				ep.shutdown(err)
+				ep.closeTransport()
+			}
+		}
+	}()
+	out = f.Call(args)
+	return
+}
@@ -0,0 +1,69 @@
+package endpoint
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Panicker int
+
+func (*Panicker) Boom(_ int, _ *int) error {
+	panic("boom")
+}
+
+func TestPanicRecover(t *testing.T) {
+	c, sc := newPair(t, new(Panicker), nil)
+	sc.Register(new(Arith))
+	if _, err := c.Call("Panicker.Boom", 0); err == nil || !strings.HasPrefix(err.Error(), ErrHandlerPanic.Error()) {
+		t.Fatalf("err = %v, want a handler panic", err)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatalf("connection unusable after a recovered panic: %v", err)
+	}
+}
+
+func TestPanicCloseConn(t *testing.T) {
+	c, sc := newPair(t, new(Panicker), []Option{WithPanicPolicy(PanicCloseConn)})
+	if _, err := c.Call("Panicker.Boom", 0); err == nil {
+		t.Fatal("call to a panicking handler succeeded")
+	}
+	if err := sc.Err(); !errors.Is(err, ErrHandlerPanic) {
+		t.Fatalf("server Err() = %v, want ErrHandlerPanic", err)
+	}
+	waitFor(t, "the client to see the close", func() bool { return c.Err() != nil })
+}
+
+func TestPanicPropagate(t *testing.T) {
+	// Dispatch runs handlers on their own goroutines, where a propagated
+	// panic would take down the test binary, so invoke is called directly.
+	ep := newEndpoint(nil, nil, nil, WithPanicPolicy(PanicPropagate))
+	boom := reflect.ValueOf(new(Panicker)).MethodByName("Boom")
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("recovered %v, want the handler's panic", r)
+		}
+	}()
+	ep.invoke(boom, []reflect.Value{reflect.ValueOf(0), reflect.ValueOf(new(int))})
+	t.Fatal("invoke returned from a panicking handler")
+}
+
+// TestPanicPropagateKillsProcess calls a panicking handler through a
+// ServerConn with PanicPropagate in a child process, which must die.
+func TestPanicPropagateKillsProcess(t *testing.T) {
+	if os.Getenv("ENDPOINT_PANIC_CHILD") == "1" {
+		c, _ := newPair(t, new(Panicker), []Option{WithPanicPolicy(PanicPropagate)})
+		c.Call("Panicker.Boom", 0)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPanicPropagateKillsProcess$")
+	cmd.Env = append(os.Environ(), "ENDPOINT_PANIC_CHILD=1")
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || !strings.Contains(string(out), "panic: boom") {
+		t.Fatalf("child exited with %v, output:\n%s\nwant it killed by the handler's panic", err, out)
+	}
+}
@@ -0,0 +1,80 @@
+package endpoint
+
+import (
+	"sync"
+)
+
+// defaultPauseBuffer is how many requests are held while paused before the
+// read loop stops reading from the connection.
+const defaultPauseBuffer = 128
+
+type pauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	closed bool
+	held   []func()
+	limit  int
+}
+
+func (g *pauseGate) init() {
+	g.cond = sync.NewCond(&g.mu)
+	if g.limit <= 0 {
+		g.limit = defaultPauseBuffer
+	}
+}
+
+// hold queues fn if the gate is paused, waiting while the buffer is full.
+// It reports whether fn was taken; false means the caller runs it now.
+func (g *pauseGate) hold(fn func()) (held bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.paused && !g.closed && len(g.held) >= g.limit {
+		g.cond.Wait()
+	}
+	if !g.paused || g.closed {
+		return false
+	}
+	g.held = append(g.held, fn)
+	return true
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	g.paused = true
+	g.mu.Unlock()
+}
+
+// resume reopens the gate and returns the requests held meanwhile, oldest
+// first.
+func (g *pauseGate) resume() (held []func()) {
+	g.mu.Lock()
+	g.paused = false
+	held, g.held = g.held, nil
+	g.mu.Unlock()
+	g.cond.Broadcast()
+	return
+}
+
+func (g *pauseGate) close() {
+	g.mu.Lock()
+	g.closed = true
+	g.held = nil
+	g.mu.Unlock()
+	g.cond.Broadcast()
+}
+
+// Pause stops dispatching incoming requests until Resume. Requests keep
+// being read and are held, up to the pause buffer; after that the
+// connection is simply not read. Nothing is rejected.
+func (ep *endpoint) Pause() {
+	ep.gate.pause()
+}
+
+// Resume dispatches the requests held since Pause and resumes normal
+// dispatch.
+func (ep *endpoint) Resume() {
+	for _, fn := range ep.gate.resume() {
+		ep.run(fn)
+	}
+}
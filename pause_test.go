@@ -0,0 +1,30 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	c, sc := newPair(t, new(Arith), nil)
+	sc.Pause()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Arith.Multiply", Args{2, 3})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("call completed while paused: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sc.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call still held after Resume")
+	}
+}
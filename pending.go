@@ -0,0 +1,152 @@
+package endpoint
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pendingShards is the number of independently locked parts of the
+// pending call map. Calls insert into and the read loop removes from the
+// shard of their msgid, so concurrent callers rarely contend.
+const pendingShards = 16
+
+type pendingShard struct {
+	mu     sync.Mutex
+	closed bool // set by shutdown; no more calls may be added
+	err    error
+	m      map[uint32]*request
+}
+
+func (ep *endpoint) shard(msgid uint32) *pendingShard {
+	return &ep.pending[msgid%pendingShards]
+}
+
+// addPending registers req under a fresh msgid, which it stores in
+// req.msgid, failing with the shutdown reason once the endpoint is closed.
+// Once msgids wrap around, ids still pending are skipped; ErrNoFreeMsgID
+// means every id is in use.
+func (ep *endpoint) addPending(req *request) (err error) {
+	for tries := uint64(0); tries <= math.MaxUint32; tries++ {
+		msgid := atomic.AddUint32(&ep.msgid, 1)
+		sh := ep.shard(msgid)
+		sh.mu.Lock()
+		if sh.closed {
+			err = sh.err
+			sh.mu.Unlock()
+			return
+		}
+		if sh.m[msgid] == nil {
+			if sh.m == nil {
+				sh.m = make(map[uint32]*request)
+			}
+			req.msgid = msgid
+			sh.m[msgid] = req
+			sh.mu.Unlock()
+			return
+		}
+		sh.mu.Unlock()
+	}
+	return ErrNoFreeMsgID
+}
+
+// takePending removes and returns the call pending on msgid, or nil.
+func (ep *endpoint) takePending(msgid uint32) (req *request) {
+	sh := ep.shard(msgid)
+	sh.mu.Lock()
+	if req = sh.m[msgid]; req != nil {
+		delete(sh.m, msgid)
+	}
+	sh.mu.Unlock()
+	return
+}
+
+// lookupPending returns the call pending on msgid without removing it.
+func (ep *endpoint) lookupPending(msgid uint32) (req *request) {
+	sh := ep.shard(msgid)
+	sh.mu.Lock()
+	req = sh.m[msgid]
+	sh.mu.Unlock()
+	return
+}
+
+// closePending closes every shard to new calls and returns the calls that
+// were still pending.
+func (ep *endpoint) closePending(err error) (reqs []*request) {
+	for i := range ep.pending {
+		sh := &ep.pending[i]
+		sh.mu.Lock()
+		sh.closed = true
+		sh.err = err
+		for _, req := range sh.m {
+			reqs = append(reqs, req)
+		}
+		sh.m = nil
+		sh.mu.Unlock()
+	}
+	return
+}
+
+// failPending removes and returns every pending call without closing the
+// shards, so new calls can still be made.
+func (ep *endpoint) failPending() (reqs []*request) {
+	for i := range ep.pending {
+		sh := &ep.pending[i]
+		sh.mu.Lock()
+		for _, req := range sh.m {
+			reqs = append(reqs, req)
+		}
+		sh.m = nil
+		sh.mu.Unlock()
+	}
+	return
+}
+
+// sealPending closes every shard to new calls with err but keeps the calls
+// already pending, so their responses are still delivered.
+func (ep *endpoint) sealPending(err error) {
+	for i := range ep.pending {
+		sh := &ep.pending[i]
+		sh.mu.Lock()
+		if !sh.closed {
+			sh.closed = true
+			sh.err = err
+		}
+		sh.mu.Unlock()
+	}
+}
+
+func (ep *endpoint) pendingEmpty() bool {
+	for i := range ep.pending {
+		sh := &ep.pending[i]
+		sh.mu.Lock()
+		n := len(sh.m)
+		sh.mu.Unlock()
+		if n > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// drainPollInterval is how often drainPending checks for outstanding
+// calls.
+const drainPollInterval = 5 * time.Millisecond
+
+// drainPending rejects new calls with ErrShutdown and waits until every
+// pending call has been answered, or ctx is done.
+func (ep *endpoint) drainPending(ctx context.Context) error {
+	ep.sealPending(ErrShutdown)
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+	for !ep.pendingEmpty() {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
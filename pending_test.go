@@ -0,0 +1,103 @@
+package endpoint
+
+import (
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// singlePending is the pending map as one mutex-guarded map, the baseline
+// the sharded map is measured against.
+type singlePending struct {
+	mu    sync.Mutex
+	msgid uint32
+	m     map[uint32]*request
+}
+
+func (p *singlePending) add(req *request) {
+	msgid := atomic.AddUint32(&p.msgid, 1)
+	p.mu.Lock()
+	req.msgid = msgid
+	p.m[msgid] = req
+	p.mu.Unlock()
+}
+
+func (p *singlePending) take(msgid uint32) (req *request) {
+	p.mu.Lock()
+	req = p.m[msgid]
+	delete(p.m, msgid)
+	p.mu.Unlock()
+	return
+}
+
+// BenchmarkPendingContention has many callers each registering a call and
+// taking its response, as Call and the read loop do.
+func BenchmarkPendingContention(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		a, peer := net.Pipe()
+		defer peer.Close()
+		c := NewClient(a, nil)
+		defer c.Close()
+		ep := c.ep
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			req := new(request)
+			for pb.Next() {
+				if err := ep.addPending(req); err != nil {
+					b.Fatal(err)
+				}
+				if ep.takePending(req.msgid) != req {
+					b.Fatal("lost a pending call")
+				}
+			}
+		})
+	})
+	b.Run("single-lock", func(b *testing.B) {
+		p := &singlePending{m: make(map[uint32]*request)}
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			req := new(request)
+			for pb.Next() {
+				p.add(req)
+				if p.take(req.msgid) != req {
+					b.Fatal("lost a pending call")
+				}
+			}
+		})
+	})
+}
+
+func TestMsgidWrapSkipsPending(t *testing.T) {
+	c, _ := newPair(t, nil, nil)
+	ep := c.ep
+	// The ids just below and just past the wrap are still in use.
+	busy := []uint32{math.MaxUint32 - 1, math.MaxUint32, 0, 1, 2}
+	for _, msgid := range busy {
+		sh := ep.shard(msgid)
+		sh.mu.Lock()
+		if sh.m == nil {
+			sh.m = make(map[uint32]*request)
+		}
+		sh.m[msgid] = &request{done: make(chan int)}
+		sh.mu.Unlock()
+	}
+	ep.msgid = math.MaxUint32 - 2
+
+	req := &request{done: make(chan int)}
+	if err := ep.addPending(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.msgid != 3 {
+		t.Fatalf("msgid = %d, want 3, the first free id after the wrap", req.msgid)
+	}
+	if ep.lookupPending(3) != req {
+		t.Fatal("call not pending under its msgid")
+	}
+	for _, msgid := range busy {
+		if r := ep.lookupPending(msgid); r == nil || r == req {
+			t.Fatalf("pending call on msgid %d was replaced", msgid)
+		}
+	}
+}
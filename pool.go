@@ -0,0 +1,102 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Pool spreads calls round-robin over several Clients, so encoding and
+// writing, which are serialized per connection, run in parallel.
+type Pool struct {
+	clients []*Client
+	next    uint32
+}
+
+// NewPool dials size connections with dial and returns a Pool of Clients
+// over them, each set up with opts. If a dial fails the connections made
+// so far are closed.
+func NewPool(size int, dial func() (net.Conn, error), handle *codec.MsgpackHandle, opts ...Option) (p *Pool, err error) {
+	if size <= 0 {
+		return nil, errors.New("rpc: pool size must be positive")
+	}
+	p = &Pool{clients: make([]*Client, 0, size)}
+	for i := 0; i < size; i++ {
+		var conn net.Conn
+		if conn, err = dial(); err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.clients = append(p.clients, NewClient(conn, handle, opts...))
+	}
+	return
+}
+
+// pick returns the next client in round-robin order.
+func (p *Pool) pick() *Client {
+	n := atomic.AddUint32(&p.next, 1)
+	return p.clients[n%uint32(len(p.clients))]
+}
+
+// Call makes a Call on the next client of the pool.
+func (p *Pool) Call(method string, params ...interface{}) (rsp interface{}, err error) {
+	return p.pick().Call(method, params...)
+}
+
+// CallContext makes a CallContext on the next client of the pool.
+func (p *Pool) CallContext(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	return p.pick().CallContext(ctx, method, params...)
+}
+
+// CallWithAffinity makes a Call on the client that key hashes to, so calls
+// with the same key go over the same connection, for backends that keep
+// state per connection.
+func (p *Pool) CallWithAffinity(key string, method string, params ...interface{}) (rsp interface{}, err error) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.clients[h.Sum32()%uint32(len(p.clients))].Call(method, params...)
+}
+
+// Race calls method on every client of the pool at once and returns the
+// first successful reply. The other calls are then cancelled through their
+// context; as with CallContext, their handlers still run on the peers. If
+// every call fails, the error of the last one to fail is returned.
+func (p *Pool) Race(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		rsp interface{}
+		err error
+	}
+	results := make(chan result, len(p.clients))
+	for _, c := range p.clients {
+		go func(c *Client) {
+			rsp, err := c.CallContext(ctx, method, params...)
+			results <- result{rsp, err}
+		}(c)
+	}
+	for range p.clients {
+		r := <-results
+		if r.err == nil {
+			return r.rsp, nil
+		}
+		err = r.err
+	}
+	return
+}
+
+// Notify sends a notification on the next client of the pool.
+func (p *Pool) Notify(method string, params ...interface{}) (err error) {
+	return p.pick().Notify(method, params...)
+}
+
+// Close closes every client of the pool.
+func (p *Pool) Close() {
+	for _, c := range p.clients {
+		c.Close()
+	}
+}
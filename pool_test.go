@@ -0,0 +1,170 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// Backend answers ID with its own number, so tests can tell which
+// connection of a pool served a call.
+type Backend int
+
+func (b *Backend) ID(_ int, reply *int) error {
+	*reply = int(*b)
+	return nil
+}
+
+// newTestPool returns a Pool of size clients, the i-th connected to a
+// server whose Backend answers i.
+func newTestPool(t testing.TB, size int) *Pool {
+	t.Helper()
+	var servers []*ServerConn
+	p, err := NewPool(size, func() (net.Conn, error) {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		id := Backend(len(servers))
+		sc.Register(&id)
+		sc.Register(new(Arith))
+		go sc.Serve()
+		servers = append(servers, sc)
+		return a, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Close()
+		for _, sc := range servers {
+			sc.Close()
+		}
+	})
+	return p
+}
+
+// backendFor returns the backend that serves a call with key.
+func backendFor(t *testing.T, p *Pool, key string) int {
+	t.Helper()
+	rsp, err := p.CallWithAffinity(key, "Backend.ID", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := rsp.(int64)
+	return int(id)
+}
+
+func TestPoolAffinity(t *testing.T) {
+	p := newTestPool(t, 4)
+	first := backendFor(t, p, "user-1")
+	for i := 0; i < 10; i++ {
+		if id := backendFor(t, p, "user-1"); id != first {
+			t.Fatalf("call %d with the same key went to backend %d, then %d", i, first, id)
+		}
+	}
+	hit := make(map[int]bool)
+	for i := 0; i < 50; i++ {
+		hit[backendFor(t, p, fmt.Sprint("user-", i))] = true
+	}
+	if len(hit) < 2 {
+		t.Fatalf("50 keys all went to backends %v", hit)
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	p := newTestPool(t, 4)
+	hits := make(map[int64]int)
+	for i := 0; i < 40; i++ {
+		rsp, err := p.Call("Backend.ID", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits[rsp.(int64)]++
+	}
+	if len(hits) != 4 {
+		t.Fatalf("calls went to backends %v, want all 4", hits)
+	}
+	for id, n := range hits {
+		if n != 10 {
+			t.Fatalf("backend %d got %d of 40 calls, want 10", id, n)
+		}
+	}
+}
+
+// BenchmarkPoolThroughput runs concurrent calls over one client and over
+// a pool of four.
+func BenchmarkPoolThroughput(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		c, _ := newPair(b, new(Arith), nil)
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+	b.Run("pool", func(b *testing.B) {
+		p := newTestPool(b, 4)
+		b.SetParallelism(16)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := p.Call("Arith.Multiply", Args{2, 3}); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// Delayed answers with its name after its delay.
+type Delayed struct {
+	name  string
+	delay time.Duration
+}
+
+func (d *Delayed) Get(_ int, reply *string) error {
+	time.Sleep(d.delay)
+	*reply = d.name
+	return nil
+}
+
+func TestPoolRace(t *testing.T) {
+	backends := []*Delayed{{"slow", time.Second}, {"fast", 0}}
+	var servers []*ServerConn
+	p, err := NewPool(2, func() (net.Conn, error) {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		sc.RegisterName(backends[len(servers)], "Delayed")
+		go sc.Serve()
+		servers = append(servers, sc)
+		return a, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		p.Close()
+		for _, sc := range servers {
+			sc.Close()
+		}
+	}()
+
+	start := time.Now()
+	rsp, err := p.Race(context.Background(), "Delayed.Get", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rsp.([]byte); string(s) != "fast" {
+		t.Fatalf("rsp = %q, want the fast backend's", rsp)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Race took %v, waiting on the slow backend", elapsed)
+	}
+	slow := p.clients[0]
+	waitFor(t, "the slow call to be cancelled", func() bool { return slow.ep.pendingCount() == 0 })
+}
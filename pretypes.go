@@ -0,0 +1,73 @@
+package endpoint
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// WithPreregisteredTypes prepares the codec for the types of the given
+// values, typically the args and replies of hot methods, so that the first
+// calls do not pay for deriving how to encode and decode them. Handlers
+// taking one of these types by value also get their arg from a pool
+// instead of a fresh allocation per call.
+func WithPreregisteredTypes(types ...interface{}) Option {
+	return func(ep *endpoint) {
+		for _, v := range types {
+			t := reflect.TypeOf(v)
+			if t == nil {
+				continue
+			}
+			ep.primeType(t)
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if ep.argPools == nil {
+				ep.argPools = make(map[reflect.Type]*sync.Pool)
+			}
+			elem := t
+			ep.argPools[t] = &sync.Pool{New: func() interface{} {
+				return reflect.New(elem).Interface()
+			}}
+		}
+	}
+}
+
+// primeType round-trips a zero value of t through the handle, filling its
+// caches for t, and decodes it with the strict handle too if that is the
+// one args of type t are decoded with.
+func (ep *endpoint) primeType(t reflect.Type) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, ep.mpk).Encode(reflect.New(t).Interface()); err != nil {
+		return
+	}
+	codec.NewDecoderBytes(b, ep.mpk).Decode(reflect.New(t).Interface())
+	if h := ep.argHandle(t); h != ep.mpk {
+		codec.NewDecoderBytes(b, h).Decode(reflect.New(t).Interface())
+	}
+}
+
+// newArg returns a pointer to a zero t, from its pool if t was
+// preregistered.
+func (ep *endpoint) newArg(t reflect.Type) reflect.Value {
+	if p := ep.argPools[t]; p != nil {
+		return reflect.ValueOf(p.Get())
+	}
+	return reflect.New(t)
+}
+
+// freeArg returns arg, decoded for argType, to its pool once the handler
+// is done with it. Args passed by pointer may be kept by the handler and
+// are never reused.
+func (ep *endpoint) freeArg(argType reflect.Type, arg reflect.Value) {
+	p := ep.argPools[argType]
+	if p == nil || argType.Kind() == reflect.Ptr {
+		return
+	}
+	arg.SetZero()
+	p.Put(arg.Addr().Interface())
+}
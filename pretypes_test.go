@@ -0,0 +1,84 @@
+package endpoint
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Order is a complex arg, with nested structs, a slice and a map.
+type Order struct {
+	ID       int64
+	Customer struct {
+		Name, Email string
+	}
+	Lines []struct {
+		SKU   string
+		Qty   int
+		Price float64
+	}
+	Tags map[string]string
+}
+
+type Orders int
+
+func (*Orders) Total(o Order, reply *float64) error {
+	for _, l := range o.Lines {
+		*reply += float64(l.Qty) * l.Price
+	}
+	return nil
+}
+
+func BenchmarkPreregisteredTypes(b *testing.B) {
+	var o Order
+	o.ID = 1
+	o.Customer.Name, o.Customer.Email = "ada", "ada@example.com"
+	o.Lines = make([]struct {
+		SKU   string
+		Qty   int
+		Price float64
+	}, 8)
+	for i := range o.Lines {
+		o.Lines[i].SKU, o.Lines[i].Qty, o.Lines[i].Price = "sku", i, 1.5
+	}
+	o.Tags = map[string]string{"channel": "web"}
+
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"preregistered", []Option{WithPreregisteredTypes(Order{})}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, _ := newPair(b, new(Orders), bc.opts)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Call("Orders.Total", o); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// firstDecodeMallocs counts the allocations of decoding an Order arg
+// into ep for the first time.
+func firstDecodeMallocs(t *testing.T, ep *endpoint) uint64 {
+	params := encodeParams(t, ep.mpk, Order{ID: 1})
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := ep.decodeArg(params, reflect.TypeOf(Order{})); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	return after.Mallocs - before.Mallocs
+}
+
+func TestPreregisteredTypesPrimeStrictHandle(t *testing.T) {
+	primed := firstDecodeMallocs(t, newEndpoint(nil, nil, nil, WithPreregisteredTypes(Order{})))
+	plain := firstDecodeMallocs(t, newEndpoint(nil, nil, nil))
+	if primed >= plain {
+		t.Fatalf("first decode of a preregistered arg made %d allocations, %d without preregistering", primed, plain)
+	}
+}
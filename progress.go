@@ -0,0 +1,47 @@
+package endpoint
+
+import (
+	"context"
+)
+
+// progressMethod is the reserved notification carrying [msgid, percent]
+// for a call still being handled by the peer.
+const progressMethod = "$progress"
+
+type progressKey struct{}
+
+type progressReporter struct {
+	ep    *endpoint
+	msgid uint32
+}
+
+func withProgress(ctx context.Context, ep *endpoint, msgid uint32) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressReporter{ep: ep, msgid: msgid})
+}
+
+// ReportProgress tells the caller of the request handled under ctx how far
+// along it is. Handlers get ctx by taking a context.Context before their
+// arg. Updates reach the caller before the reply.
+func ReportProgress(ctx context.Context, percent int) error {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return ErrNoRequest
+	}
+	return r.ep.Notify(progressMethod, r.msgid, percent)
+}
+
+// CallWithProgress is Call, invoking progress for each update the handler
+// reports with ReportProgress. progress runs on the read loop and must not
+// block.
+func (ep *endpoint) CallWithProgress(method string, progress func(percent int), params ...interface{}) (rsp interface{}, err error) {
+	req := &request{progress: progress}
+	return ep.roundTrip(context.Background(), req, method, params, ep.await)
+}
+
+// onProgress delivers a $progress update to the pending call it names.
+func (ep *endpoint) onProgress(msgid uint32, percent int) {
+	req := ep.lookupPending(msgid)
+	if req != nil && req.progress != nil {
+		req.progress(percent)
+	}
+}
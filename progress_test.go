@@ -0,0 +1,43 @@
+package endpoint
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type Job int
+
+func (*Job) Run(ctx context.Context, steps int, reply *string) error {
+	for i := 1; i <= steps; i++ {
+		if err := ReportProgress(ctx, i*100/steps); err != nil {
+			return err
+		}
+	}
+	*reply = "done"
+	return nil
+}
+
+func TestCallWithProgress(t *testing.T) {
+	c, _ := newPair(t, new(Job), nil)
+	var seen []int
+	rsp, err := c.CallWithProgress("Job.Run", func(percent int) {
+		seen = append(seen, percent)
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rsp.([]byte); string(s) != "done" {
+		t.Fatalf("rsp = %v", rsp)
+	}
+	// Every update arrived before the result.
+	if want := []int{25, 50, 75, 100}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("progress = %v, want %v", seen, want)
+	}
+}
+
+func TestReportProgressOutsideRequest(t *testing.T) {
+	if err := ReportProgress(context.Background(), 50); err != ErrNoRequest {
+		t.Fatalf("err = %v, want ErrNoRequest", err)
+	}
+}
@@ -0,0 +1,189 @@
+package endpoint
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// readRequest decodes one request with dec and returns its msgid.
+func readRequest(t *testing.T, dec *codec.Decoder) uint32 {
+	t.Helper()
+	var req []interface{}
+	if err := dec.Decode(&req); err != nil {
+		t.Error(err)
+		return 0
+	}
+	switch msgid := req[1].(type) {
+	case int64:
+		return uint32(msgid)
+	case uint64:
+		return uint32(msgid)
+	}
+	t.Errorf("msgid %T", req[1])
+	return 0
+}
+
+func TestReadingDeliversResponse(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	c := NewClient(a, nil)
+	defer c.Close()
+	h := new(codec.MsgpackHandle)
+	go func() {
+		msgid := readRequest(t, codec.NewDecoder(b, h))
+		codec.NewEncoder(b, h).Encode([]interface{}{msgpackRPCRsp, msgid, nil, 42})
+	}()
+	rsp, err := c.Call("Any.Method", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 42 {
+		t.Fatalf("rsp = %v, want 42", rsp)
+	}
+}
+
+func TestReadingEOFFailsPending(t *testing.T) {
+	a, b := net.Pipe()
+	c := NewClient(a, nil)
+	defer c.Close()
+	go func() {
+		readRequest(t, codec.NewDecoder(b, new(codec.MsgpackHandle)))
+		b.Close()
+	}()
+	if _, err := c.Call("Any.Method", 1); !errors.Is(err, io.EOF) {
+		t.Fatalf("call error = %v, want EOF", err)
+	}
+	if !errors.Is(c.Err(), io.EOF) {
+		t.Fatalf("Err() = %v, want EOF", c.Err())
+	}
+	if n := c.ep.pendingCount(); n != 0 {
+		t.Fatalf("%d calls still pending", n)
+	}
+}
+
+func TestReadingStopsWhenClosed(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	ep := newEndpoint(NewConnTransport(a, nil), a, nil)
+	closed := make(chan int)
+	done := make(chan error, 1)
+	go func() { done <- ep.Reading(closed) }()
+	close(closed)
+	select {
+	case err := <-done:
+		if err != ErrShutdown {
+			t.Fatalf("Reading returned %v, want ErrShutdown", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Reading did not return after closed was closed")
+	}
+}
+
+func TestDuplicateResponseDeliveredOnce(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	dups := make(chan uint32, 1)
+	c := NewClient(a, nil, WithDuplicateResponseHook(func(msgid uint32) { dups <- msgid }))
+	defer c.Close()
+	h := new(codec.MsgpackHandle)
+	go func() {
+		msgid := readRequest(t, codec.NewDecoder(b, h))
+		enc := codec.NewEncoder(b, h)
+		enc.Encode([]interface{}{msgpackRPCRsp, msgid, nil, 1})
+		enc.Encode([]interface{}{msgpackRPCRsp, msgid, nil, 2})
+	}()
+	rsp, err := c.Call("Any.Method", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 1 {
+		t.Fatalf("rsp = %v, want the first response", rsp)
+	}
+	select {
+	case <-dups:
+	case <-time.After(time.Second):
+		t.Fatal("second response was not reported as a duplicate")
+	}
+}
+
+func TestUnknownMsgidAfterNotifications(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	log := new(captureLogger)
+	c := NewClient(a, nil, WithUnknownResponseLogging(), WithLogger(log))
+	defer c.Close()
+	h := new(codec.MsgpackHandle)
+	go func() {
+		dec, enc := codec.NewDecoder(b, h), codec.NewEncoder(b, h)
+		var notify []interface{}
+		for i := 0; i < 3; i++ {
+			if err := dec.Decode(&notify); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		// No call is pending, so no msgid can match.
+		enc.Encode([]interface{}{msgpackRPCRsp, 12345, nil, "stray"})
+		msgid := readRequest(t, dec)
+		enc.Encode([]interface{}{msgpackRPCRsp, msgid, nil, 42})
+	}()
+	for i := 0; i < 3; i++ {
+		if err := c.Notify("Log.Write", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the stray response to be logged", func() bool { return len(log.logged()) > 0 })
+	if got := log.logged()[0]; !strings.Contains(got, "12345") {
+		t.Fatalf("logged %q, want the unknown msgid", got)
+	}
+	// The read loop survived and still delivers responses.
+	rsp, err := c.Call("Arith.Multiply", Args{6, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 42 {
+		t.Fatalf("rsp = %v, want 42", rsp)
+	}
+}
+
+type Rows int
+
+func (*Rows) Get(n int, reply *[]Args) error {
+	*reply = make([]Args, n)
+	for i := range *reply {
+		(*reply)[i] = Args{i, -i}
+	}
+	return nil
+}
+
+// BenchmarkPipelinedReplies has 32 calls in flight at once, each answered
+// with a 1000-row reply, with replies decoded on the read loop and on
+// separate goroutines.
+func BenchmarkPipelinedReplies(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"read-loop", nil},
+		{"concurrent", []Option{WithConcurrentReplyDecode()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, _ := newPair(b, new(Rows), nil, bc.opts...)
+			b.SetParallelism(32)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := c.Call("Rows.Get", 1000); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DialFunc opens a new connection for a reconnecting Client.
+type DialFunc func() (net.Conn, error)
+
+// defaultReconnectBackoff is the wait between redial attempts unless set
+// with WithReconnect.
+const defaultReconnectBackoff = time.Second
+
+// WithDialFunc makes a Client reconnect with dial when its connection
+// dies, instead of shutting down. Calls pending at that moment, and calls
+// made until a new connection is up, fail with ErrConnClosed; later calls
+// go over the new connection. Registered services and options carry over.
+func WithDialFunc(dial DialFunc) Option {
+	return func(ep *endpoint) {
+		ep.dial = dial
+	}
+}
+
+// WithReconnect sets the wait between failed redial attempts of a Client
+// using WithDialFunc.
+func WithReconnect(backoff time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.backoff = backoff
+	}
+}
+
+// WithCallRetry makes a Client reconnecting with WithDialFunc send a call
+// that failed with ErrConnClosed again, up to n times, each time once a
+// new connection is up. The failed attempt may still have run on the
+// server; retry only idempotent calls, or make them with CallIdempotent
+// against a DedupCache.
+func WithCallRetry(n int) Option {
+	return func(ep *endpoint) {
+		ep.retries = n
+	}
+}
+
+// waitUp waits until the endpoint is not reconnecting, failing if it is
+// closed or ctx is done first.
+func (ep *endpoint) waitUp(ctx context.Context) error {
+	ep.mu.Lock()
+	down, up := ep.down, ep.up
+	ep.mu.Unlock()
+	if !down {
+		return nil
+	}
+	select {
+	case <-up:
+		return nil
+	case <-ep.done:
+		return ep.closedErr()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reconnect replaces the dead transport with a connection from ep.dial,
+// retrying until it succeeds. It reports false if the endpoint was closed
+// meanwhile.
+func (ep *endpoint) reconnect(cause error) bool {
+	ep.mu.Lock()
+	ep.down = true
+	ep.up = make(chan struct{})
+	old := ep.tr
+	ep.mu.Unlock()
+	old.Close()
+	err := fmt.Errorf("%w: %v", ErrConnClosed, cause)
+	for _, req := range ep.failPending() {
+		req.err = err
+		close(req.done)
+	}
+	backoff := ep.backoff
+	if backoff <= 0 {
+		backoff = defaultReconnectBackoff
+	}
+	for ep.closedErr() == nil {
+		conn, err := ep.dial()
+		if err != nil {
+			ep.logger.Printf("rpc: reconnect: %v", err)
+			time.Sleep(backoff)
+			continue
+		}
+		ep.tuneConn(conn)
+		ep.mu.Lock()
+		if ep.closedErr() != nil {
+			ep.mu.Unlock()
+			conn.Close()
+			return false
+		}
+		ep.tr, ep.conn, ep.down = NewConnTransport(conn, ep.mpk), conn, false
+		ep.limitFrames(ep.tr)
+		ep.peerGone.Store(false) // a $goodbye was from the old peer
+		close(ep.up)
+		ep.mu.Unlock()
+		go ep.resendUnacked()
+		return true
+	}
+	return false
+}
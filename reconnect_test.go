@@ -0,0 +1,50 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	serve := func() net.Conn {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		sc.Register(new(Arith))
+		sc.Register(&Events{ch: make(chan int)})
+		go sc.Serve()
+		t.Cleanup(sc.Close)
+		return a
+	}
+	first := serve()
+	dialed := make(chan struct{}, 1)
+	dial := func() (net.Conn, error) {
+		dialed <- struct{}{}
+		return serve(), nil
+	}
+	c := NewClient(first, nil, WithDialFunc(dial), WithReconnect(time.Millisecond))
+	defer c.Close()
+
+	inflight := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Events.Next", 0)
+		inflight <- err
+	}()
+	waitFor(t, "the call to be sent", func() bool { return c.ep.pendingCount() == 1 })
+	first.Close()
+	if err := <-inflight; !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("in-flight call = %v, want ErrConnClosed", err)
+	}
+
+	<-dialed
+	var rsp interface{}
+	var err error
+	waitFor(t, "a call over the new connection", func() bool {
+		rsp, err = c.Call("Arith.Multiply", Args{4, 5})
+		return err == nil
+	})
+	if n, _ := rsp.(int64); n != 20 {
+		t.Fatalf("rsp = %v, want 20", rsp)
+	}
+}
@@ -0,0 +1,182 @@
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Acker has a method with an arg and no results, an acknowledged call.
+type Acker chan Args
+
+func (a Acker) Ack(args *Args) {
+	a <- *args
+}
+
+func TestReplylessMethod(t *testing.T) {
+	acks := make(Acker, 1)
+	c, _ := newPair(t, acks, nil)
+	rsp, err := c.Call("Acker.Ack", Args{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp != nil {
+		t.Fatalf("rsp = %v, want nil", rsp)
+	}
+	if got := <-acks; got != (Args{1, 2}) {
+		t.Fatalf("handler got %+v", got)
+	}
+}
+
+func TestMaxServices(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil, WithMaxServices(3))
+	for i := 0; i < 3; i++ {
+		if err := ep.RegisterName(new(Arith), fmt.Sprint("Arith", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ep.RegisterName(new(Arith), "Arith3"); !errors.Is(err, ErrTooManyServices) {
+		t.Fatalf("err = %v, want ErrTooManyServices", err)
+	}
+}
+
+func TestMethodSignature(t *testing.T) {
+	sc := NewServerConnTransport(nil, nil)
+	sc.Register(new(Arith))
+	sc.Register(make(Acker))
+	arg, reply, ok := sc.MethodSignature("Arith.Multiply")
+	if !ok || arg != reflect.TypeOf(Args{}) || reply != reflect.TypeOf(new(int)) {
+		t.Fatalf("Arith.Multiply = %v, %v, %v", arg, reply, ok)
+	}
+	arg, reply, ok = sc.MethodSignature("Acker.Ack")
+	if !ok || arg != reflect.TypeOf(&Args{}) || reply != nil {
+		t.Fatalf("Acker.Ack = %v, %v, %v", arg, reply, ok)
+	}
+	for _, name := range []string{"Arith.Nope", "Nope.Multiply", "Arith"} {
+		if _, _, ok = sc.MethodSignature(name); ok {
+			t.Errorf("MethodSignature(%q) found a method", name)
+		}
+	}
+}
+
+func TestRegisterThenRegisterMethodConflict(t *testing.T) {
+	ar := new(Arith)
+	ep := newEndpoint(nil, nil, nil)
+	if err := ep.Register(ar); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.RegisterMethod(ar.Multiply); !errors.Is(err, ErrDuplicateMethod) {
+		t.Fatalf("RegisterMethod after Register = %v, want ErrDuplicateMethod", err)
+	}
+
+	// The other way round, the whole service clashes.
+	ep = newEndpoint(nil, nil, nil)
+	if err := ep.RegisterMethod(ar.Multiply); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.Register(ar); !errors.Is(err, ErrDuplicateService) {
+		t.Fatalf("Register after RegisterMethod = %v, want ErrDuplicateService", err)
+	}
+	if _, _, ok := ep.MethodSignature("Arith.Multiply"); !ok {
+		t.Fatal("RegisterMethod did not register Arith.Multiply")
+	}
+}
+
+type item struct{}
+
+// Items is exported but holds unexported elements.
+type Items []item
+
+type Ints []int
+
+// Tree refers to itself.
+type Tree []Tree
+
+func TestIsExportedOrBuiltinType(t *testing.T) {
+	for _, tc := range []struct {
+		v    interface{}
+		want bool
+	}{
+		{new(int), true},
+		{new(**Args), true},
+		{new(**item), false},
+		{new(Ints), true},
+		{new(Items), false},
+		{new([]item), false},
+		{new(map[string]*item), false},
+		{new(map[string]Ints), true},
+		{new(Tree), true},
+	} {
+		if got := isExportedOrBuiltinType(reflect.TypeOf(tc.v)); got != tc.want {
+			t.Errorf("isExportedOrBuiltinType(%T) = %v, want %v", tc.v, got, tc.want)
+		}
+	}
+}
+
+// Mixed has one method on the value and one on the pointer receiver.
+type Mixed int
+
+func (Mixed) Double(n int, reply *int) error {
+	*reply = 2 * n
+	return nil
+}
+
+func (*Mixed) Triple(n int, reply *int) error {
+	*reply = 3 * n
+	return nil
+}
+
+func TestRegisterValueAndPointer(t *testing.T) {
+	ep := newEndpoint(nil, nil, nil)
+	if err := ep.Register(Mixed(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.RegisterName(new(Mixed), "PMixed"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"Mixed.Double":  true,
+		"Mixed.Triple":  false, // not in the method set of a value
+		"PMixed.Double": true,
+		"PMixed.Triple": true,
+	} {
+		if _, _, ok := ep.MethodSignature(name); ok != want {
+			t.Errorf("%s registered = %v, want %v", name, ok, want)
+		}
+	}
+
+	if err := ep.Register(new(Mixed)); !errors.Is(err, ErrDuplicateService) {
+		t.Fatalf("second Register = %v, want ErrDuplicateService", err)
+	}
+	// Arith's methods all have pointer receivers.
+	err := ep.Register(Arith(0))
+	if err == nil || !strings.Contains(err.Error(), "hint: pass a pointer") {
+		t.Fatalf("Register of a value without methods = %v, want the pointer hint", err)
+	}
+}
+
+type Private int
+
+func (*Private) Take(arg item, reply *int) error { return nil }
+
+func (*Private) Keep(arg int, reply *int) error { return nil }
+
+func TestUnexportedArgTypeRejected(t *testing.T) {
+	log := new(captureLogger)
+	ep := newEndpoint(nil, nil, nil, WithLogger(log))
+	if err := ep.Register(new(Private)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := ep.MethodSignature("Private.Take"); ok {
+		t.Fatal("method with an unexported arg type was registered")
+	}
+	if _, _, ok := ep.MethodSignature("Private.Keep"); !ok {
+		t.Fatal("Private.Keep was not registered")
+	}
+	lines := log.logged()
+	if len(lines) != 1 || !strings.Contains(lines[0], "Take argument type not exported") {
+		t.Fatalf("logged %q, want the reason Take was rejected", lines)
+	}
+}
@@ -0,0 +1,117 @@
+package endpoint
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/ugorji/go/codec"
+)
+
+// reliableMethod is the reserved notification carrying a ReliableNotify
+// as [seq, method, params]. The receiver runs the inner notification and
+// confirms it with ackMethod [seq].
+const (
+	reliableMethod = "$reliable"
+	ackMethod      = "$ack"
+)
+
+// maxUnacked bounds the notifications ReliableNotify keeps for redelivery.
+const maxUnacked = 1024
+
+// ErrTooManyUnacked fails a ReliableNotify while maxUnacked earlier ones
+// are still waiting for their ack.
+var ErrTooManyUnacked = errors.New("rpc: too many unacknowledged notifications")
+
+// unacked holds the encoded ReliableNotify messages not yet acked, by seq.
+type unacked struct {
+	mu   sync.Mutex
+	seq  uint64
+	msgs map[uint64][]byte
+}
+
+// ReliableNotify sends a notification that is delivered at least once. It
+// is kept until the peer acknowledges it and sent again each time a Client
+// set up with WithDialFunc reconnects, so the peer's handler may run more
+// than once. It returns nil once the notification is sent or queued for the
+// next connection.
+func (ep *endpoint) ReliableNotify(method string, params ...interface{}) (err error) {
+	if ep.checkUTF8 && !validStrings(params) {
+		return ErrInvalidUTF8
+	}
+	ep.reliable.mu.Lock()
+	if len(ep.reliable.msgs) >= maxUnacked {
+		ep.reliable.mu.Unlock()
+		return ErrTooManyUnacked
+	}
+	ep.reliable.seq++
+	seq := ep.reliable.seq
+	ep.reliable.mu.Unlock()
+
+	nobj := []interface{}{msgpackRPCNotify, reliableMethod, []interface{}{seq, method, wireParams(params)}}
+	msg, err := ep.encode(method, nobj)
+	if err != nil {
+		return
+	}
+	ep.reliable.mu.Lock()
+	if ep.reliable.msgs == nil {
+		ep.reliable.msgs = make(map[uint64][]byte)
+	}
+	ep.reliable.msgs[seq] = msg
+	ep.reliable.mu.Unlock()
+	if err = ep.write(msg); errors.Is(err, ErrConnClosed) {
+		// Sent again once the connection is back.
+		err = nil
+	} else if err != nil {
+		ep.ack(seq)
+	}
+	return
+}
+
+// ack forgets the ReliableNotify numbered seq.
+func (ep *endpoint) ack(seq uint64) {
+	ep.reliable.mu.Lock()
+	delete(ep.reliable.msgs, seq)
+	ep.reliable.mu.Unlock()
+}
+
+// resendUnacked sends every unacknowledged ReliableNotify again, oldest
+// first, after a reconnect.
+func (ep *endpoint) resendUnacked() {
+	ep.reliable.mu.Lock()
+	seqs := make([]uint64, 0, len(ep.reliable.msgs))
+	for seq := range ep.reliable.msgs {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	msgs := make([][]byte, len(seqs))
+	for i, seq := range seqs {
+		msgs[i] = ep.reliable.msgs[seq]
+	}
+	ep.reliable.mu.Unlock()
+	for _, msg := range msgs {
+		if err := ep.write(msg); err != nil {
+			// Another reconnect will try again.
+			return
+		}
+	}
+}
+
+// onReliable acks a $reliable notification and then runs the notification
+// it carries. The ack is written off the read loop.
+func (ep *endpoint) onReliable(params codec.Raw) {
+	var parts []codec.Raw
+	var seq uint64
+	var method string
+	if ep.decodeRaw(params, &parts) != nil || len(parts) != 3 ||
+		ep.decodeRaw(parts[0], &seq) != nil || ep.decodeRaw(parts[1], &method) != nil {
+		ep.logger.Printf("rpc: malformed %s notification", reliableMethod)
+		return
+	}
+	ep.run(func() {
+		if err := ep.Notify(ackMethod, seq); err != nil {
+			ep.logger.Printf("rpc: %s %d: %v", ackMethod, seq, err)
+		}
+	})
+	ep.dispatchNotify(method, parts[2], nil)
+}
@@ -0,0 +1,65 @@
+package endpoint
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type Sink chan int
+
+func (s Sink) Put(v int) { s <- v }
+
+func (ep *endpoint) unackedCount() int {
+	ep.reliable.mu.Lock()
+	defer ep.reliable.mu.Unlock()
+	return len(ep.reliable.msgs)
+}
+
+func TestReliableNotifyRedelivered(t *testing.T) {
+	sink := make(Sink, 1)
+	a, b := net.Pipe()
+	dropped := make(chan struct{})
+	go func() {
+		// The first peer reads the notification and dies without acking.
+		NewConnTransport(b, nil).ReadMessage()
+		b.Close()
+		close(dropped)
+	}()
+	dial := func() (net.Conn, error) {
+		a, b := net.Pipe()
+		sc := NewServerConn(b, nil)
+		sc.Register(sink)
+		go sc.Serve()
+		t.Cleanup(sc.Close)
+		return a, nil
+	}
+	c := NewClient(a, nil, WithDialFunc(dial), WithReconnect(10*time.Millisecond))
+	defer c.Close()
+
+	if err := c.ReliableNotify("Sink.Put", 42); err != nil {
+		t.Fatal(err)
+	}
+	<-dropped
+	select {
+	case v := <-sink:
+		if v != 42 {
+			t.Fatalf("handler got %d, want 42", v)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("notification was not redelivered after reconnect")
+	}
+	waitFor(t, "ack", func() bool { return c.ep.unackedCount() == 0 })
+}
+
+func TestReliableNotifyAcked(t *testing.T) {
+	sink := make(Sink, 3)
+	c, _ := newPair(t, sink, nil)
+	for i := 1; i <= 3; i++ {
+		if err := c.ReliableNotify("Sink.Put", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "acks", func() bool { return c.ep.unackedCount() == 0 })
+	waitFor(t, "handlers", func() bool { return len(sink) == 3 })
+}
@@ -0,0 +1,77 @@
+package endpoint
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestReverseOrderReplies(t *testing.T) {
+	const calls = 100
+	a, b := net.Pipe()
+	defer b.Close()
+	late := make(chan uint32, 1)
+	c := NewClient(a, nil,
+		WithCallTimeout(2*time.Second),
+		WithDuplicateResponseHook(func(msgid uint32) { late <- msgid }))
+	defer c.Close()
+
+	h := new(codec.MsgpackHandle)
+	tr := NewConnTransport(b, h)
+	go func() {
+		var req struct {
+			_struct bool `codec:",toarray"`
+			Type    int
+			MsgID   uint32
+			Method  string
+			Params  []int64
+		}
+		var ids []uint32
+		var args []int64
+		for i := 0; i < calls; i++ {
+			msg, err := tr.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = codec.NewDecoderBytes(msg, h).Decode(&req); err != nil {
+				t.Error(err)
+				return
+			}
+			ids = append(ids, req.MsgID)
+			args = append(args, req.Params[0])
+		}
+		send := func(msgid uint32, result int64) {
+			var out []byte
+			codec.NewEncoderBytes(&out, h).Encode([]interface{}{msgpackRPCRsp, msgid, nil, result})
+			tr.WriteMessage(out)
+		}
+		send(999999, 1) // nobody waits on this one
+		for i := len(ids) - 1; i >= 0; i-- {
+			send(ids[i], args[i]*10)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var r int
+			if err := c.CallResult("Any.Method", &r, i); err != nil || r != i*10 {
+				t.Errorf("call %d: got %d, %v", i, r, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	select {
+	case msgid := <-late:
+		if msgid != 999999 {
+			t.Fatalf("unexpected response for msgid %d", msgid)
+		}
+	default:
+		t.Fatal("the response nobody waited on was not reported")
+	}
+}
@@ -0,0 +1,188 @@
+package endpoint
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+const (
+	mdTimestamp = "ts"
+	mdNonce     = "nonce"
+	mdSignature = "sig"
+)
+
+// ErrReplayedRequest answers a request whose timestamp is outside the
+// ReplayGuard's window, or whose nonce was already seen within it.
+var ErrReplayedRequest = errors.New("rpc: replayed or stale request")
+
+// ErrBadSignature answers a request whose timestamp and nonce are missing,
+// or whose signature does not match its method, params and metadata under
+// the ReplayGuard's key.
+var ErrBadSignature = errors.New("rpc: bad request signature")
+
+// WithRequestSigning sends a timestamp and a random nonce with every
+// request and notification, signed with an HMAC-SHA256 of key over them,
+// the method, the params and the rest of the metadata, for peers using a
+// ReplayGuard. Notifications carry the metadata as a fourth element.
+func WithRequestSigning(key []byte) Option {
+	return func(ep *endpoint) {
+		ep.signKey = key
+	}
+}
+
+// ReplayGuard rejects requests and notifications that are not signed with
+// its key, that were signed more than window away from the server's clock,
+// or that repeat a nonce seen within the window.
+type ReplayGuard struct {
+	key    []byte
+	window time.Duration
+	mu     sync.Mutex
+	seen   map[string]struct{}
+	queue  []seenNonce // the nonces in seen, oldest first
+}
+
+// seenNonce is a nonce to forget once its request is stale anyway.
+type seenNonce struct {
+	nonce  string
+	forget time.Time
+}
+
+// NewReplayGuard returns a guard for requests signed with key by clients
+// using WithRequestSigning.
+func NewReplayGuard(key []byte, window time.Duration) *ReplayGuard {
+	return &ReplayGuard{
+		key:    key,
+		window: window,
+		seen:   make(map[string]struct{}),
+	}
+}
+
+// WithReplayGuard checks every incoming request and notification with g
+// before it is dispatched. Share g between the ServerConns a request could
+// be replayed to.
+func WithReplayGuard(g *ReplayGuard) Option {
+	return func(ep *endpoint) {
+		ep.replay = g
+	}
+}
+
+// signature returns the hex HMAC of a message's method, encoded params and
+// encoded metadata fields, taken in key order.
+func signature(key []byte, method string, params []byte, fields map[string]codec.Raw) string {
+	mac := hmac.New(sha256.New, key)
+	write := func(b []byte) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+		mac.Write(n[:])
+		mac.Write(b)
+	}
+	write([]byte(method))
+	write(params)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write([]byte(k))
+		write(fields[k])
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signFrame returns a copy of the request or notification reqobj with its
+// params and metadata encoded, and a fresh timestamp, nonce and signature
+// added to the metadata. Anything else is returned as it is.
+func (ep *endpoint) signFrame(reqobj []interface{}) (signed []interface{}, err error) {
+	var at int // where the method is; the params and metadata follow it
+	switch reqobj[0] {
+	case msgpackRPCReq:
+		at = 2
+	case msgpackRPCNotify:
+		at = 1
+	default:
+		return reqobj, nil
+	}
+	method, _ := reqobj[at].(string)
+	params, err := ep.marshal(reqobj[at+1])
+	if err != nil {
+		return
+	}
+	var md Metadata
+	if len(reqobj) > at+2 {
+		md, _ = reqobj[at+2].(Metadata)
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	fields := make(map[string]codec.Raw, len(md)+3)
+	for k, v := range md {
+		if fields[k], err = ep.marshal(v); err != nil {
+			return
+		}
+	}
+	if fields[mdTimestamp], err = ep.marshal(time.Now().UnixNano()); err != nil {
+		return
+	}
+	if fields[mdNonce], err = ep.marshal(hex.EncodeToString(b[:])); err != nil {
+		return
+	}
+	delete(fields, mdSignature)
+	if fields[mdSignature], err = ep.marshal(signature(ep.signKey, method, params, fields)); err != nil {
+		return
+	}
+	signed = append(append([]interface{}{}, reqobj[:at+1]...), codec.Raw(params), fields)
+	return
+}
+
+// checkReplay verifies meta, the metadata of an incoming request or
+// notification for method with params, and admits it at most once.
+func (ep *endpoint) checkReplay(method string, params, meta codec.Raw) error {
+	var fields map[string]codec.Raw
+	var ts int64
+	var nonce, sig string
+	if ep.decodeRaw(meta, &fields) != nil || len(fields[mdTimestamp]) == 0 ||
+		ep.decodeRaw(fields[mdTimestamp], &ts) != nil ||
+		ep.decodeRaw(fields[mdNonce], &nonce) != nil ||
+		ep.decodeRaw(fields[mdSignature], &sig) != nil || nonce == "" {
+		return ErrBadSignature
+	}
+	delete(fields, mdSignature)
+	if !hmac.Equal([]byte(sig), []byte(signature(ep.replay.key, method, params, fields))) {
+		return ErrBadSignature
+	}
+	return ep.replay.admit(ts, nonce)
+}
+
+// admit accepts a message signed at ts with nonce once, if ts is within
+// the window.
+func (g *ReplayGuard) admit(ts int64, nonce string) error {
+	now := time.Now()
+	at := time.Unix(0, ts)
+	if at.Before(now.Add(-g.window)) || at.After(now.Add(g.window)) {
+		return ErrReplayedRequest
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for len(g.queue) > 0 && now.After(g.queue[0].forget) {
+		delete(g.seen, g.queue[0].nonce)
+		g.queue = g.queue[1:]
+	}
+	if _, ok := g.seen[nonce]; ok {
+		return ErrReplayedRequest
+	}
+	// By then the timestamp alone rejects the message: it is at most
+	// window ahead of now. Forgetting at the same delay after every
+	// insertion keeps the queue in time order.
+	g.seen[nonce] = struct{}{}
+	g.queue = append(g.queue, seenNonce{nonce, now.Add(2 * g.window)})
+	return nil
+}
@@ -0,0 +1,185 @@
+package endpoint
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// rawExchange writes msg to a new ServerConn serving Arith with opts and
+// returns the error element of its response.
+func rawExchange(t *testing.T, msg []byte, opts ...Option) (rerr interface{}) {
+	t.Helper()
+	a, b := net.Pipe()
+	defer a.Close()
+	sc := NewServerConn(b, nil, opts...)
+	defer sc.Close()
+	sc.Register(new(Arith))
+	go sc.Serve()
+	tr := NewConnTransport(a, nil)
+	if err := tr.WriteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := tr.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []interface{}
+	if err = codec.NewDecoderBytes(rsp, new(codec.MsgpackHandle)).Decode(&parts); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := parts[2].([]byte); ok {
+		return string(s)
+	}
+	return parts[2]
+}
+
+func TestReplayGuard(t *testing.T) {
+	key := []byte("secret")
+	guard := NewReplayGuard(key, time.Minute)
+	c, rec := newRecordedPair(t, new(Arith), []Option{WithReplayGuard(guard)}, WithRequestSigning(key))
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	captured := rec.messages()[0]
+
+	// The same bytes sent again, here on another connection sharing the
+	// guard, are refused.
+	if rerr := rawExchange(t, captured, WithReplayGuard(guard)); rerr != ErrReplayedRequest.Error() {
+		t.Fatalf("replayed request answered with %v, want %v", rerr, ErrReplayedRequest)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatalf("fresh request refused: %v", err)
+	}
+
+	// So are requests signed with another key or not at all.
+	other, _ := newPair(t, new(Arith), []Option{WithReplayGuard(guard)}, WithRequestSigning([]byte("other")))
+	if _, err := other.Call("Arith.Multiply", Args{2, 3}); err == nil || err.Error() != ErrBadSignature.Error() {
+		t.Fatalf("wrongly signed request answered with %v, want %v", err, ErrBadSignature)
+	}
+	unsigned, _ := newPair(t, new(Arith), []Option{WithReplayGuard(guard)})
+	if _, err := unsigned.Call("Arith.Multiply", Args{2, 3}); err == nil || err.Error() != ErrBadSignature.Error() {
+		t.Fatalf("unsigned request answered with %v, want %v", err, ErrBadSignature)
+	}
+}
+
+// reencode returns the frame msg with element i replaced by v.
+func reencode(t *testing.T, msg []byte, i int, v interface{}) []byte {
+	t.Helper()
+	var parts []codec.Raw
+	h := new(codec.MsgpackHandle)
+	h.Raw = true
+	if err := codec.NewDecoderBytes(msg, h).Decode(&parts); err != nil {
+		t.Fatal(err)
+	}
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, h).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	parts[i] = b
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, h).Encode(parts); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestReplayGuardTampered(t *testing.T) {
+	key := []byte("secret")
+	c, rec := newRecordedPair(t, new(Arith), []Option{WithReplayGuard(NewReplayGuard(key, time.Minute))},
+		WithRequestSigning(key), WithClientID("alice"))
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	captured := rec.messages()[0]
+	var parts []codec.Raw
+	if err := codec.NewDecoderBytes(captured, new(codec.MsgpackHandle)).Decode(&parts); err != nil {
+		t.Fatal(err)
+	}
+	var md map[string]interface{}
+	if err := codec.NewDecoderBytes(parts[4], new(codec.MsgpackHandle)).Decode(&md); err != nil {
+		t.Fatal(err)
+	}
+	md[mdClientID] = "mallory"
+	for name, msg := range map[string][]byte{
+		"params":   reencode(t, captured, 3, []interface{}{Args{2, 4}}),
+		"metadata": reencode(t, captured, 4, md),
+		"method":   reencode(t, captured, 2, "Arith.Divide"),
+	} {
+		// A fresh guard has not seen the nonce, so only the signature
+		// can give the change away.
+		if rerr := rawExchange(t, msg, WithReplayGuard(NewReplayGuard(key, time.Minute))); rerr != ErrBadSignature.Error() {
+			t.Errorf("request with changed %s answered with %v, want %v", name, rerr, ErrBadSignature)
+		}
+	}
+}
+
+func TestReplayGuardNotify(t *testing.T) {
+	key := []byte("secret")
+	signer := newEndpoint(nil, nil, nil, WithRequestSigning(key))
+	notify := func(args Args) []byte {
+		msg, err := signer.encode("Acker.Ack", []interface{}{msgpackRPCNotify, "Acker.Ack", []interface{}{args}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	first, second := notify(Args{1, 1}), notify(Args{2, 2})
+
+	a, b := net.Pipe()
+	defer a.Close()
+	log := new(captureLogger)
+	acks := make(Acker, 2)
+	sc := NewServerConn(b, nil, WithReplayGuard(NewReplayGuard(key, time.Minute)), WithLogger(log))
+	defer sc.Close()
+	sc.Register(acks)
+	go sc.Serve()
+	tr := NewConnTransport(a, nil)
+	for _, msg := range [][]byte{first, first, second} {
+		if err := tr.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Handlers run concurrently, so the two acks come in either order.
+	got := make(map[Args]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case args := <-acks:
+			got[args] = true
+		case <-time.After(time.Second):
+			t.Fatalf("only %d notifications delivered", i)
+		}
+	}
+	if !got[Args{1, 1}] || !got[Args{2, 2}] {
+		t.Fatalf("handlers got %v, want both notifications once", got)
+	}
+	// The read loop checked the replay before it read the second
+	// notification.
+	if logged := log.logged(); len(logged) != 1 || !strings.Contains(logged[0], ErrReplayedRequest.Error()) {
+		t.Fatalf("logged %q, want the replay rejected", logged)
+	}
+}
+
+func TestReplayGuardStale(t *testing.T) {
+	g := NewReplayGuard([]byte("secret"), time.Second)
+	if err := g.admit(time.Now().Add(-time.Minute).UnixNano(), "n"); err != ErrReplayedRequest {
+		t.Fatalf("stale request: %v, want %v", err, ErrReplayedRequest)
+	}
+}
+
+func TestReplayGuardForgets(t *testing.T) {
+	g := NewReplayGuard([]byte("secret"), 10*time.Millisecond)
+	if err := g.admit(time.Now().UnixNano(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := g.admit(time.Now().UnixNano(), "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.seen["a"]; ok || len(g.queue) != 1 {
+		t.Fatalf("seen %v, queue %v: want only b remembered", g.seen, g.queue)
+	}
+}
@@ -0,0 +1,68 @@
+package endpoint
+
+import (
+	"sync"
+)
+
+// replyBudget bounds the bytes of replies that have arrived but not yet
+// been picked up by their callers, such as uncommitted Speculate calls.
+// New calls wait while the budget is exhausted.
+type replyBudget struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int
+	used   int
+	closed bool
+}
+
+// WithMaxPendingReplyBytes blocks new calls while more than n bytes of
+// replies are waiting to be consumed. Zero means no limit.
+func WithMaxPendingReplyBytes(n int) Option {
+	return func(ep *endpoint) {
+		ep.replies.max = n
+	}
+}
+
+func (b *replyBudget) init() {
+	b.cond = sync.NewCond(&b.mu)
+}
+
+// acquire waits until the budget has room for another call.
+func (b *replyBudget) acquire() {
+	if b.max <= 0 {
+		return
+	}
+	b.mu.Lock()
+	for b.used >= b.max && !b.closed {
+		b.cond.Wait()
+	}
+	b.mu.Unlock()
+}
+
+// add accounts for a reply of n bytes that has been delivered.
+func (b *replyBudget) add(n int) {
+	if b.max <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+// release returns n bytes once the reply has been consumed.
+func (b *replyBudget) release(n int) {
+	if b.max <= 0 || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *replyBudget) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
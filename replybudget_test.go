@@ -0,0 +1,52 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+)
+
+type Blobs int
+
+func (*Blobs) Make(n int, reply *[]byte) error {
+	*reply = make([]byte, n)
+	return nil
+}
+
+func TestMaxPendingReplyBytes(t *testing.T) {
+	c, _ := newPair(t, new(Blobs), nil, WithMaxPendingReplyBytes(1000))
+	_, cancel1 := c.Speculate("Blobs.Make", 600)
+	commit2, _ := c.Speculate("Blobs.Make", 600)
+	waitFor(t, "replies", func() bool { return c.ep.pendingCount() == 0 })
+
+	// Both replies are buffered, over budget: the next call must wait.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Call("Blobs.Make", 10)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("call over budget returned early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Cancelling after the reply arrived must give its bytes back.
+	cancel1()
+	if _, err := commit2(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call still blocked after the budget was released")
+	}
+	c.ep.replies.mu.Lock()
+	used := c.ep.replies.used
+	c.ep.replies.mu.Unlock()
+	if used != 0 {
+		t.Fatalf("budget used = %d after all replies were consumed", used)
+	}
+}
@@ -1,21 +1,41 @@
 package endpoint
 
 import (
+	"context"
 	"net"
+	"reflect"
+	"sync"
 
 	"github.com/ugorji/go/codec"
 )
 
+// ServerConn is the accepting side of a connection. Besides serving its
+// own services it can call services registered on the Client.
 type ServerConn struct {
 	ep     *endpoint
 	conn   net.Conn
 	closed chan int
+	once   sync.Once
 }
 
-func NewServerConn(conn net.Conn, mpk *codec.MsgpackHandle) *ServerConn {
+// NewServerConn returns a ServerConn over conn. A nil mpk means a default
+// MsgpackHandle, and a given one is copied rather than changed; with a nil
+// conn Serve and every call fail with ErrNoConn.
+func NewServerConn(conn net.Conn, mpk *codec.MsgpackHandle, opts ...Option) *ServerConn {
+	mpk = ownHandle(mpk)
 	return &ServerConn{
-		conn: conn,
-		ep:   newEndpoint(conn, mpk),
+		conn:   conn,
+		ep:     newEndpoint(transportFor(conn, mpk), conn, mpk, opts...),
+		closed: make(chan int),
+	}
+}
+
+// NewServerConnTransport returns a ServerConn exchanging messages over tr
+// rather than a net.Conn.
+func NewServerConnTransport(tr Transport, mpk *codec.MsgpackHandle, opts ...Option) *ServerConn {
+	return &ServerConn{
+		ep:     newEndpoint(tr, nil, ownHandle(mpk), opts...),
+		closed: make(chan int),
 	}
 }
 
@@ -24,18 +44,142 @@ func (sc *ServerConn) Serve() error {
 }
 
 func (sc *ServerConn) Call(method string, params ...interface{}) (rsp interface{}, err error) {
-	return sc.ep.Call(method, params)
+	return sc.ep.Call(method, params...)
+}
+
+// CallContext is Call, giving up when ctx is done; see endpoint.CallContext.
+func (sc *ServerConn) CallContext(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	return sc.ep.CallContext(ctx, method, params...)
+}
+
+// CallResult is Call, decoding the reply into the pointer result; see
+// endpoint.CallResult.
+func (sc *ServerConn) CallResult(method string, result interface{}, params ...interface{}) (err error) {
+	return sc.ep.CallResult(method, result, params...)
+}
+
+// CallArrayStream is Call returning an array reply as an iterator; see
+// endpoint.CallArrayStream.
+func (sc *ServerConn) CallArrayStream(method string, params ...interface{}) (it *ArrayIter, err error) {
+	return sc.ep.CallArrayStream(method, params...)
+}
+
+// CallBatch sends several calls with one write; see endpoint.CallBatch.
+func (sc *ServerConn) CallBatch(calls []BatchCall) []BatchResult {
+	return sc.ep.CallBatch(calls)
+}
+
+// LongPoll is a call the server may hold until an event happens; see
+// endpoint.LongPoll.
+func (sc *ServerConn) LongPoll(ctx context.Context, method string, params ...interface{}) (rsp interface{}, err error) {
+	return sc.ep.LongPoll(ctx, method, params...)
+}
+
+// Speculate issues a call without waiting for it; see endpoint.Speculate.
+func (sc *ServerConn) Speculate(method string, params ...interface{}) (commit func() (interface{}, error), cancel func()) {
+	return sc.ep.Speculate(method, params...)
 }
 
 func (sc *ServerConn) Notify(method string, params ...interface{}) (err error) {
-	return sc.ep.Notify(method, params)
+	return sc.ep.Notify(method, params...)
+}
+
+// NotifyStruct sends arg itself as the params of a notification; see
+// endpoint.NotifyStruct.
+func (sc *ServerConn) NotifyStruct(method string, arg interface{}) (err error) {
+	return sc.ep.NotifyStruct(method, arg)
+}
+
+// NotifyThenCall sends a notification and a call with nothing in between;
+// see endpoint.NotifyThenCall.
+func (sc *ServerConn) NotifyThenCall(notify string, notifyParams []interface{}, method string, params ...interface{}) (rsp interface{}, err error) {
+	return sc.ep.NotifyThenCall(notify, notifyParams, method, params...)
+}
+
+// Stats returns how many times each method registered on this side of
+// the connection has been called, keyed by "Service.Method".
+func (sc *ServerConn) Stats() MethodStats {
+	return sc.ep.Stats()
+}
+
+// SnapshotAndReset returns the call counts and zeroes them.
+func (sc *ServerConn) SnapshotAndReset() MethodStats {
+	return sc.ep.SnapshotAndReset()
+}
+
+// ResetStats zeroes the call counts.
+func (sc *ServerConn) ResetStats() {
+	sc.ep.ResetStats()
 }
 
 func (sc *ServerConn) Register(svc interface{}) (err error) {
 	return sc.ep.Register(svc)
 }
 
+func (sc *ServerConn) RegisterName(svc interface{}, name string) (err error) {
+	return sc.ep.RegisterName(svc, name)
+}
+
+func (sc *ServerConn) RegisterMethod(method interface{}) (err error) {
+	return sc.ep.RegisterMethod(method)
+}
+
+func (sc *ServerConn) RegisterMethodName(method interface{}, name string) (err error) {
+	return sc.ep.RegisterMethodName(method, name)
+}
+
+// MethodSignature reports the arg and reply types of the registered method
+// fullName ("Service.Method"), for building clients at runtime.
+func (sc *ServerConn) MethodSignature(fullName string) (argType, replyType reflect.Type, ok bool) {
+	return sc.ep.MethodSignature(fullName)
+}
+
+// InFlightRequests lists the requests whose handlers are still running.
+func (sc *ServerConn) InFlightRequests() []RequestInfo {
+	return sc.ep.InFlightRequests()
+}
+
+// Pause holds incoming requests without rejecting them until Resume.
+func (sc *ServerConn) Pause() {
+	sc.ep.Pause()
+}
+
+// Resume dispatches the requests held since Pause.
+func (sc *ServerConn) Resume() {
+	sc.ep.Resume()
+}
+
+// Close shuts the connection down; outstanding calls fail with ErrShutdown.
 func (sc *ServerConn) Close() {
-	close(sc.closed)
-	sc.conn.Close()
+	sc.once.Do(func() {
+		close(sc.closed)
+		sc.ep.Close()
+	})
+}
+
+// CloseGracefully stops new calls, which fail with ErrShutdown, waits for
+// the calls already made to be answered and then closes the connection.
+// If ctx is done first the connection is closed anyway, failing the
+// remaining calls, and ctx.Err() is returned.
+func (sc *ServerConn) CloseGracefully(ctx context.Context) (err error) {
+	err = sc.ep.drainPending(ctx)
+	sc.Close()
+	return
+}
+
+// RemoteAddr returns the remote address of the connection, or nil without one.
+func (sc *ServerConn) RemoteAddr() net.Addr {
+	return sc.ep.RemoteAddr()
+}
+
+// Err returns why the connection ended: ErrShutdown after Close, otherwise
+// the error that stopped the read loop. It is nil while the connection is
+// up.
+func (sc *ServerConn) Err() error {
+	return sc.ep.Err()
+}
+
+// Done returns a channel that is closed when the connection ends.
+func (sc *ServerConn) Done() <-chan struct{} {
+	return sc.ep.Done()
 }
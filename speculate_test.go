@@ -0,0 +1,32 @@
+package endpoint
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSpeculate(t *testing.T) {
+	gate := make(Gate)
+	defer close(gate)
+	c, _ := newPair(t, gate, nil)
+	c2, _ := newPair(t, new(Arith), nil)
+
+	commit, _ := c2.Speculate("Arith.Multiply", Args{2, 3})
+	rsp, err := commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 6 {
+		t.Fatalf("rsp = %v, want 6", rsp)
+	}
+
+	// The handler is still waiting on the gate when the call is cancelled.
+	commit, cancel := c.Speculate("Gate.Wait", Args{1, 2})
+	cancel()
+	if _, err = commit(); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("commit after cancel = %v, want ErrCanceled", err)
+	}
+	if n := c.ep.pendingCount(); n != 0 {
+		t.Fatalf("%d calls still pending after cancel", n)
+	}
+}
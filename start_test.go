@@ -0,0 +1,42 @@
+package endpoint
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStartTimeoutClosedConn(t *testing.T) {
+	a, b := net.Pipe()
+	a.Close()
+	b.Close()
+	c := NewClient(a, nil, WithStartTimeout(time.Second))
+	if err := c.Err(); !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("Err() = %v, want ErrStartTimeout", err)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{1, 2}); !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("call error = %v, want ErrStartTimeout", err)
+	}
+}
+
+func TestStartTimeoutElapsed(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	// No read loop is ever run, so the start can only time out.
+	ep := newEndpoint(NewConnTransport(a, nil), a, nil, WithStartTimeout(10*time.Millisecond))
+	ep.waitReady()
+	if err := ep.Err(); !errors.Is(err, ErrStartTimeout) {
+		t.Fatalf("Err() = %v, want ErrStartTimeout", err)
+	}
+}
+
+func TestStartTimeoutOpenConn(t *testing.T) {
+	c, _ := newPair(t, new(Arith), nil, WithStartTimeout(time.Second))
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Call("Arith.Multiply", Args{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+}
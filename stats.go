@@ -0,0 +1,62 @@
+package endpoint
+
+// MethodStats maps "Service.Method" to the number of calls dispatched to
+// it.
+type MethodStats map[string]uint
+
+// NumCalls returns how many times the method has been dispatched.
+func (m *methodType) NumCalls() (n uint) {
+	m.Lock()
+	n = m.numCalls
+	m.Unlock()
+	return
+}
+
+func (m *methodType) incCalls() {
+	m.Lock()
+	m.numCalls++
+	m.Unlock()
+}
+
+// takeCalls returns the call count and zeroes it in one step, so a call
+// racing with it is counted in exactly one snapshot.
+func (m *methodType) takeCalls() (n uint) {
+	m.Lock()
+	n, m.numCalls = m.numCalls, 0
+	m.Unlock()
+	return
+}
+
+// Stats returns a snapshot of the call counts of every registered method.
+func (ep *endpoint) Stats() MethodStats {
+	return ep.collectStats(false)
+}
+
+// ResetStats zeroes the call counts of every registered method.
+func (ep *endpoint) ResetStats() {
+	ep.collectStats(true)
+}
+
+// SnapshotAndReset returns the call counts and zeroes them. Each counter is
+// read and cleared atomically, so periodic exports never count a call twice
+// or miss one.
+func (ep *endpoint) SnapshotAndReset() MethodStats {
+	return ep.collectStats(true)
+}
+
+func (ep *endpoint) collectStats(reset bool) MethodStats {
+	stats := make(MethodStats)
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	for sname, svc := range ep.serviceMap {
+		// Notify handlers are in svc.method too.
+		for mname, mtype := range svc.method {
+			if reset {
+				stats[sname+"."+mname] = mtype.takeCalls()
+			} else {
+				stats[sname+"."+mname] = mtype.NumCalls()
+			}
+		}
+	}
+	return stats
+}
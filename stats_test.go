@@ -0,0 +1,54 @@
+package endpoint
+
+import "testing"
+
+func TestStatsSnapshotAndReset(t *testing.T) {
+	c, sc := newPair(t, new(Arith), nil)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Call("Arith.Multiply", Args{i, 2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.Call("Arith.Divide", Args{4, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if st := sc.Stats(); st["Arith.Multiply"] != 3 || st["Arith.Divide"] != 1 {
+		t.Fatalf("Stats() = %v, want 3 Multiply and 1 Divide", st)
+	}
+	// Stats does not reset, so the counts keep accumulating.
+	c.Call("Arith.Multiply", Args{1, 1})
+	if st := sc.SnapshotAndReset(); st["Arith.Multiply"] != 4 || st["Arith.Divide"] != 1 {
+		t.Fatalf("SnapshotAndReset() = %v, want 4 Multiply and 1 Divide", st)
+	}
+	if st := sc.Stats(); st["Arith.Multiply"] != 0 || st["Arith.Divide"] != 0 {
+		t.Fatalf("Stats() after reset = %v, want zeros", st)
+	}
+
+	c.Call("Arith.Divide", Args{4, 2})
+	sc.ResetStats()
+	if st := sc.Stats(); st["Arith.Divide"] != 0 {
+		t.Fatalf("Stats() after ResetStats = %v, want zeros", st)
+	}
+}
+
+func TestStatsCountsCalls(t *testing.T) {
+	const n = 25
+	c, sc := newPair(t, new(Arith), nil)
+	for i := 0; i < n; i++ {
+		if _, err := c.Call("Arith.Multiply", Args{i, i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := sc.Stats()
+	if st["Arith.Multiply"] != n {
+		t.Fatalf("Arith.Multiply count = %d, want %d", st["Arith.Multiply"], n)
+	}
+	// The snapshot is a copy.
+	st["Arith.Multiply"] = 0
+	if got := sc.Stats()["Arith.Multiply"]; got != n {
+		t.Fatalf("count = %d after editing a snapshot, want %d", got, n)
+	}
+	if got := c.Stats()["Arith.Multiply"]; got != 0 {
+		t.Fatalf("client side count = %d, want 0", got)
+	}
+}
@@ -0,0 +1,41 @@
+package endpoint
+
+import (
+	"context"
+	"time"
+)
+
+// WithGlobalHandlerTimeout gives every dispatched handler a context that
+// expires after d, unless WithMethodTimeout sets one for its method.
+// Handlers see the deadline through the context.Context they take; one
+// that returns after it expires is answered with
+// context.DeadlineExceeded.
+func WithGlobalHandlerTimeout(d time.Duration) Option {
+	return func(ep *endpoint) {
+		ep.handlerTimeout = d
+	}
+}
+
+// WithMethodTimeout sets the handler timeout for method ("Service.Method"),
+// overriding WithGlobalHandlerTimeout. A zero d disables the timeout for
+// that method.
+func WithMethodTimeout(method string, d time.Duration) Option {
+	return func(ep *endpoint) {
+		if ep.methodTimeouts == nil {
+			ep.methodTimeouts = make(map[string]time.Duration)
+		}
+		ep.methodTimeouts[method] = d
+	}
+}
+
+// handlerContext derives the context a handler for method runs under.
+func (ep *endpoint) handlerContext(ctx context.Context, method string) (context.Context, context.CancelFunc) {
+	d, ok := ep.methodTimeouts[method]
+	if !ok {
+		d = ep.handlerTimeout
+	}
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,82 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go io.Copy(io.Discard, b) // a peer that reads but never answers
+	c := NewClient(a, nil, WithReadTimeout(50*time.Millisecond))
+	defer c.Close()
+
+	if _, err := c.Call("Arith.Multiply", Args{1, 2}); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("call error = %v, want ErrReadTimeout", err)
+	}
+	if err := c.Err(); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("Err() = %v, want ErrReadTimeout", err)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	a, b := net.Pipe() // nobody reads b, so writes to a stall
+	defer b.Close()
+	exited := make(chan ExitCause, 1)
+	c := NewClient(a, nil,
+		WithWriteTimeout(50*time.Millisecond),
+		WithReadLoopExitHook(func(err error, cause ExitCause) { exited <- cause }))
+	defer c.Close()
+
+	if _, err := c.Call("Arith.Multiply", Args{1, 2}); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("call error = %v, want a deadline error", err)
+	}
+	select {
+	case cause := <-exited:
+		if cause != ExitWriteFailure {
+			t.Fatalf("exit cause = %v, want %v", cause, ExitWriteFailure)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read loop still running after the write failed")
+	}
+}
+
+func TestGlobalHandlerTimeout(t *testing.T) {
+	c, _ := newPair(t, new(Sleeper), []Option{WithGlobalHandlerTimeout(20 * time.Millisecond)})
+	if _, err := c.Call("Sleeper.Sleep", int64(50*time.Millisecond)); err == nil || err.Error() != context.DeadlineExceeded.Error() {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A per-method timeout overrides the global one.
+	c, _ = newPair(t, new(Sleeper), []Option{
+		WithGlobalHandlerTimeout(20 * time.Millisecond),
+		WithMethodTimeout("Sleeper.Sleep", time.Second),
+	})
+	if _, err := c.Call("Sleeper.Sleep", int64(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	c, _ := newPair(t, &Events{ch: make(chan int)}, nil, WithCallTimeout(20*time.Millisecond))
+	if _, err := c.Call("Events.Next", 0); !errors.Is(err, ErrCallTimeout) {
+		t.Fatalf("err = %v, want ErrCallTimeout", err)
+	}
+	if n := c.ep.pendingCount(); n != 0 {
+		t.Fatalf("%d calls still pending after the timeout", n)
+	}
+
+	// Zero means no timeout.
+	ev := &Events{ch: make(chan int)}
+	c, _ = newPair(t, ev, nil, WithCallTimeout(0))
+	time.AfterFunc(50*time.Millisecond, func() { ev.ch <- 7 })
+	if _, err := c.Call("Events.Next", 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// HandshakeError is returned by DialTLS and NewServerConnTLS when the
+// connection was made but the TLS handshake failed, for instance over an
+// untrusted certificate.
+type HandshakeError struct {
+	Err error
+}
+
+func (e *HandshakeError) Error() string {
+	return "rpc: tls handshake: " + e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// handshakeTimeout bounds every TLS handshake, so a peer that connects
+// and then says nothing cannot hold a constructor forever.
+var handshakeTimeout = 10 * time.Second
+
+// DialTLS connects to addr on the named network, completes a TLS handshake
+// using tlsConfig and returns a Client over the secured connection. If
+// tlsConfig names no server, the host part of addr is verified.
+func DialTLS(network, addr string, tlsConfig *tls.Config, handle *codec.MsgpackHandle, opts ...Option) (c *Client, err error) {
+	return DialTLSContext(context.Background(), network, addr, tlsConfig, handle, opts...)
+}
+
+// DialTLSContext is DialTLS giving up when ctx is cancelled or its deadline
+// passes, whether while connecting or during the handshake.
+func DialTLSContext(ctx context.Context, network, addr string, tlsConfig *tls.Config, handle *codec.MsgpackHandle, opts ...Option) (c *Client, err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return
+	}
+	cfg := tlsConfig
+	if cfg == nil || cfg.ServerName == "" {
+		if cfg == nil {
+			cfg = new(tls.Config)
+		} else {
+			cfg = cfg.Clone()
+		}
+		cfg.ServerName = addr
+		if host, _, serr := net.SplitHostPort(addr); serr == nil {
+			cfg.ServerName = host
+		}
+	}
+	tc := tls.Client(conn, cfg)
+	if err = handshake(ctx, tc); err != nil {
+		conn.Close()
+		return nil, &HandshakeError{Err: err}
+	}
+	c = NewClient(tc, handle, opts...)
+	return
+}
+
+// NewServerConnTLS completes a TLS handshake over rawConn, as accepted from
+// a listener, and returns a ServerConn over the secured connection.
+func NewServerConnTLS(rawConn net.Conn, tlsConfig *tls.Config, handle *codec.MsgpackHandle, opts ...Option) (sc *ServerConn, err error) {
+	tc := tls.Server(rawConn, tlsConfig)
+	if err = handshake(context.Background(), tc); err != nil {
+		rawConn.Close()
+		return nil, &HandshakeError{Err: err}
+	}
+	sc = NewServerConn(tc, handle, opts...)
+	return
+}
+
+// handshake runs tc's handshake, bounded by ctx and handshakeTimeout.
+func handshake(ctx context.Context, tc *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	return tc.HandshakeContext(ctx)
+}
+
+type peerCertKey struct{}
+
+// withPeerCert adds the certificate the peer presented over TLS, if any,
+// to a handler's ctx.
+func (ep *endpoint) withPeerCert(ctx context.Context) context.Context {
+	ep.mu.Lock()
+	tc, ok := ep.conn.(*tls.Conn)
+	ep.mu.Unlock()
+	if !ok {
+		return ctx
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, peerCertKey{}, certs[0])
+}
+
+// PeerCertFromContext returns the certificate the caller presented when
+// the request being handled under ctx arrived over TLS, as with mutual TLS
+// configured through tls.Config.ClientAuth.
+func PeerCertFromContext(ctx context.Context) (cert *x509.Certificate, ok bool) {
+	cert, ok = ctx.Value(peerCertKey{}).(*x509.Certificate)
+	return
+}
@@ -0,0 +1,168 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a certificate for localhost and 127.0.0.1 with the
+// given common name, signed by its own key.
+func selfSigned(t *testing.T, cn string) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// serveTLS accepts TLS connections on a loopback listener and serves svc
+// on each. It returns the listener's address.
+func serveTLS(t *testing.T, cfg *tls.Config, svc interface{}) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			raw, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sc, err := NewServerConnTLS(raw, cfg, nil)
+				if err != nil {
+					return
+				}
+				defer sc.Close()
+				sc.Register(svc)
+				sc.Serve()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestTLSRoundTrip(t *testing.T) {
+	cert, x := selfSigned(t, "server")
+	addr := serveTLS(t, &tls.Config{Certificates: []tls.Certificate{cert}}, new(Arith))
+	roots := x509.NewCertPool()
+	roots.AddCert(x)
+
+	c, err := DialTLS("tcp", addr, &tls.Config{RootCAs: roots}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	rsp, err := c.Call("Arith.Multiply", Args{3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 12 {
+		t.Fatalf("rsp = %v, want 12", rsp)
+	}
+
+	_, err = DialTLS("tcp", addr, nil, nil) // the cert is not trusted
+	var he *HandshakeError
+	if !errors.As(err, &he) {
+		t.Fatalf("err = %v, want a HandshakeError", err)
+	}
+}
+
+func TestTLSHandshakeBounded(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// Accept and then say nothing.
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = DialTLSContext(ctx, "tcp", l.Addr().String(), nil, nil)
+	var he *HandshakeError
+	if !errors.As(err, &he) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a HandshakeError for the deadline", err)
+	}
+
+	defer func(d time.Duration) { handshakeTimeout = d }(handshakeTimeout)
+	handshakeTimeout = 50 * time.Millisecond
+	a, b := net.Pipe() // a never speaks
+	defer a.Close()
+	if _, err = NewServerConnTLS(b, &tls.Config{}, nil); !errors.As(err, &he) {
+		t.Fatalf("err = %v, want a HandshakeError", err)
+	}
+}
+
+type Identity int
+
+func (*Identity) Whoami(ctx context.Context, _ int, reply *string) error {
+	if cert, ok := PeerCertFromContext(ctx); ok {
+		*reply = cert.Subject.CommonName
+	}
+	return nil
+}
+
+func TestMutualTLSPeerCert(t *testing.T) {
+	srvCert, srvX := selfSigned(t, "server")
+	cliCert, cliX := selfSigned(t, "client-7")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cliX)
+	addr := serveTLS(t, &tls.Config{
+		Certificates: []tls.Certificate{srvCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}, new(Identity))
+	roots := x509.NewCertPool()
+	roots.AddCert(srvX)
+
+	c, err := DialTLS("tcp", addr, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cliCert}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	rsp, err := c.Call("Identity.Whoami", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cn, _ := rsp.([]byte); string(cn) != "client-7" {
+		t.Fatalf("handler saw common name %q, want client-7", rsp)
+	}
+}
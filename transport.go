@@ -0,0 +1,155 @@
+package endpoint
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+// Transport carries whole msgpack-rpc messages between two peers. Each
+// message is a complete msgpack value. ReadMessage is only ever called from
+// the endpoint's read loop and WriteMessage is serialized by the endpoint,
+// so implementations need not lock.
+type Transport interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(msg []byte) error
+	Close() error
+}
+
+// batchWriter is implemented by transports that can write several
+// messages at once.
+type batchWriter interface {
+	WriteMessages(msgs [][]byte) error
+}
+
+// readBufferSize is the connection read buffer. A burst of small messages
+// lands in it with one read and is then decoded without further syscalls.
+const readBufferSize = 32 << 10
+
+// connTransport adapts a net.Conn to Transport. msgpack values are
+// self-delimiting, so messages are framed by decoding one raw value at a time.
+type connTransport struct {
+	conn net.Conn
+	src  *frameReader
+	dec  *codec.Decoder
+}
+
+// frameReader reads the connection for the decoder, refusing to read more
+// than max bytes past the start of the current frame.
+type frameReader struct {
+	r     io.Reader
+	max   int64 // zero means no limit
+	read  int64 // bytes read from r
+	start int64 // offset of the current frame
+}
+
+func (f *frameReader) Read(p []byte) (n int, err error) {
+	if f.max > 0 {
+		room := f.start + f.max - f.read
+		if room <= 0 {
+			return 0, ErrFrameTooLarge
+		}
+		if int64(len(p)) > room {
+			p = p[:room]
+		}
+	}
+	n, err = f.r.Read(p)
+	f.read += int64(n)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// The codec retries reads that pass a deadline, which would spin.
+		err = ErrReadTimeout
+	}
+	return
+}
+
+// NewConnTransport returns a Transport sending messages over conn. The
+// codec only frames raw values larger than 64KiB correctly when it does
+// the buffering itself, so unless mpk sets a ReaderBufferSize, conn is read
+// through a copy of mpk with a readBufferSize buffer.
+func NewConnTransport(conn net.Conn, mpk *codec.MsgpackHandle) Transport {
+	if mpk == nil {
+		mpk = new(codec.MsgpackHandle)
+	}
+	if mpk.ReaderBufferSize == 0 {
+		mpk = copyHandle(mpk)
+		mpk.ReaderBufferSize = readBufferSize
+	}
+	src := &frameReader{r: conn}
+	return &connTransport{
+		conn: conn,
+		src:  src,
+		dec:  codec.NewDecoder(src, mpk),
+	}
+}
+
+// copyHandle returns a copy of mpk, extensions included, that can be
+// configured without changing mpk.
+func copyHandle(mpk *codec.MsgpackHandle) *codec.MsgpackHandle {
+	h := new(codec.MsgpackHandle)
+	reflect.ValueOf(h).Elem().Set(reflect.ValueOf(mpk).Elem())
+	return h
+}
+
+// transportFor wraps conn, returning no transport at all for a nil conn.
+func transportFor(conn net.Conn, mpk *codec.MsgpackHandle) Transport {
+	if conn == nil {
+		return nil
+	}
+	return NewConnTransport(conn, mpk)
+}
+
+func (t *connTransport) ReadMessage() (msg []byte, err error) {
+	var raw codec.Raw
+	if err = t.dec.Decode(&raw); err != nil {
+		if errors.Is(err, ErrFrameTooLarge) {
+			err = ErrFrameTooLarge
+		} else if errors.Is(err, ErrReadTimeout) {
+			err = ErrReadTimeout
+		}
+		return
+	}
+	t.src.start += int64(len(raw))
+	// raw points into the decoder's buffer, which the next read reuses.
+	msg = append([]byte(nil), raw...)
+	return
+}
+
+func (t *connTransport) WriteMessage(msg []byte) (err error) {
+	_, err = t.conn.Write(msg)
+	return
+}
+
+// setMaxFrame limits incoming messages to n bytes; zero means no limit.
+func (t *connTransport) setMaxFrame(n int) {
+	t.src.max = int64(n)
+}
+
+// limitFrames applies WithMaxFrameSize to tr, if it reads a net.Conn.
+func (ep *endpoint) limitFrames(tr Transport) {
+	if ct, ok := tr.(*connTransport); ok {
+		ct.setMaxFrame(ep.maxFrame)
+	}
+}
+
+// WriteMessages writes msgs in one go: with writev on TCP and Unix
+// connections, which take them as they are, and as one joined buffer on
+// others, where net.Buffers would fall back to a write per message.
+func (t *connTransport) WriteMessages(msgs [][]byte) (err error) {
+	switch t.conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		bufs := net.Buffers(msgs)
+		_, err = bufs.WriteTo(t.conn)
+	default:
+		_, err = t.conn.Write(bytes.Join(msgs, nil))
+	}
+	return
+}
+
+func (t *connTransport) Close() error {
+	return t.conn.Close()
+}
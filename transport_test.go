@@ -0,0 +1,204 @@
+package endpoint
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+// memTransport is one end of an in-memory Transport pair.
+type memTransport struct {
+	in, out chan []byte
+	done    chan struct{}
+	once    *sync.Once
+}
+
+func memPipe() (a, b *memTransport) {
+	ab, ba := make(chan []byte, 16), make(chan []byte, 16)
+	done, once := make(chan struct{}), new(sync.Once)
+	return &memTransport{in: ba, out: ab, done: done, once: once},
+		&memTransport{in: ab, out: ba, done: done, once: once}
+}
+
+func (t *memTransport) ReadMessage() ([]byte, error) {
+	select {
+	case msg := <-t.in:
+		return msg, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *memTransport) WriteMessage(msg []byte) error {
+	select {
+	case t.out <- append([]byte(nil), msg...):
+		return nil
+	case <-t.done:
+		return io.ErrClosedPipe
+	}
+}
+
+func (t *memTransport) Close() error {
+	t.once.Do(func() { close(t.done) })
+	return nil
+}
+
+func TestInMemoryTransport(t *testing.T) {
+	a, b := memPipe()
+	sc := NewServerConnTransport(b, nil)
+	sc.Register(new(Arith))
+	go sc.Serve()
+	c := NewClientTransport(a, nil)
+	defer c.Close()
+	rsp, err := c.Call("Arith.Multiply", Args{6, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := rsp.(int64); n != 42 {
+		t.Fatalf("rsp = %v, want 42", rsp)
+	}
+}
+
+// readCounter is a net.Conn that only reads, from r, counting the reads.
+type readCounter struct {
+	net.Conn
+	r     io.Reader
+	reads int
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+// burst returns n small notifications encoded back to back, as they would
+// arrive in one write, and the size of each.
+func burst(tb testing.TB, n int) (b []byte, size int) {
+	tb.Helper()
+	var msg []byte
+	if err := codec.NewEncoderBytes(&msg, new(codec.MsgpackHandle)).Encode([]interface{}{msgpackRPCNotify, "Sink.Put", []interface{}{1}}); err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.Repeat(msg, n), len(msg)
+}
+
+func TestBufferedReads(t *testing.T) {
+	b, _ := burst(t, 1000)
+	conn := &readCounter{r: bytes.NewReader(b)}
+	tr := NewConnTransport(conn, nil)
+	for i := 0; i < 1000; i++ {
+		if _, err := tr.ReadMessage(); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	// A read per message would take 1000.
+	if conn.reads > 10 {
+		t.Fatalf("%d reads for 1000 messages", conn.reads)
+	}
+}
+
+func BenchmarkReadBurst(b *testing.B) {
+	data, _ := burst(b, 1000)
+	b.Run("transport", func(b *testing.B) {
+		reads := 0
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			conn := &readCounter{r: bytes.NewReader(data)}
+			tr := NewConnTransport(conn, nil)
+			b.StartTimer()
+			for j := 0; j < 1000; j++ {
+				if _, err := tr.ReadMessage(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reads += conn.reads
+		}
+		b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+	})
+	b.Run("unbuffered", func(b *testing.B) {
+		reads := 0
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			conn := &readCounter{r: bytes.NewReader(data)}
+			dec := codec.NewDecoder(conn, new(codec.MsgpackHandle))
+			b.StartTimer()
+			for j := 0; j < 1000; j++ {
+				var raw codec.Raw
+				if err := dec.Decode(&raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+			reads += conn.reads
+		}
+		b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+	})
+}
+
+func TestReadMessageOwned(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	tr := NewConnTransport(b, new(codec.MsgpackHandle))
+	defer tr.Close()
+	go func() {
+		enc := codec.NewEncoder(a, new(codec.MsgpackHandle))
+		enc.Encode([]interface{}{msgpackRPCNotify, "Sink.Put", []interface{}{"first"}})
+		enc.Encode([]interface{}{msgpackRPCNotify, "Sink.Put", []interface{}{"second"}})
+	}()
+	first, err := tr.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(nil), first...)
+	if _, err := tr.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, want) {
+		t.Fatalf("first message = %q after the next read, want %q", first, want)
+	}
+}
+
+func TestReadLargeMessage(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	tr := NewConnTransport(b, new(codec.MsgpackHandle))
+	defer tr.Close()
+	big := bytes.Repeat([]byte("x"), 100<<10)
+	go func() {
+		enc := codec.NewEncoder(a, new(codec.MsgpackHandle))
+		enc.Encode([]interface{}{msgpackRPCNotify, "Sink.Put", []interface{}{big}})
+		enc.Encode([]interface{}{msgpackRPCNotify, "Sink.Put", []interface{}{"next"}})
+	}()
+	for _, want := range [][]byte{big, []byte("next")} {
+		msg, err := tr.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v []interface{}
+		if err := codec.NewDecoderBytes(msg, new(codec.MsgpackHandle)).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		params, _ := v[2].([]interface{})
+		if len(params) != 1 || !bytes.Equal(params[0].([]byte), want) {
+			t.Fatalf("message = %.40q..., want params [%.20q...]", msg, want)
+		}
+	}
+}
+
+func TestConnTransportKeepsHandle(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	mpk := new(codec.MsgpackHandle)
+	tr := NewConnTransport(b, mpk)
+	defer tr.Close()
+	go a.Write([]byte{0x93, msgpackRPCNotify, 0xa1, 'x', 0x90})
+	if _, err := tr.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if mpk.ReaderBufferSize != 0 {
+		t.Fatalf("ReaderBufferSize = %d on the caller's handle, want 0", mpk.ReaderBufferSize)
+	}
+}
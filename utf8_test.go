@@ -0,0 +1,34 @@
+package endpoint
+
+import (
+	"errors"
+	"testing"
+)
+
+type Echo int
+
+func (*Echo) String(s string, reply *string) error {
+	*reply = s
+	return nil
+}
+
+func TestStringValidation(t *testing.T) {
+	c, _ := newPair(t, new(Echo), nil, WithStringValidation())
+	if _, err := c.Call("Echo.String", "caf\xe9"); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("err = %v, want ErrInvalidUTF8", err)
+	}
+	rsp, err := c.Call("Echo.String", "café")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := rsp.([]byte); string(s) != "café" {
+		t.Fatalf("rsp = %q", rsp)
+	}
+}
+
+func TestStringValidationOfReplies(t *testing.T) {
+	c, _ := newPair(t, new(Echo), []Option{WithStringValidation()})
+	if _, err := c.Call("Echo.String", "caf\xe9"); err == nil || err.Error() != ErrInvalidUTF8.Error() {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidUTF8)
+	}
+}
@@ -0,0 +1,138 @@
+package endpoint
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ugorji/go/codec"
+)
+
+// structTagKeys are the struct tag keys honoured when encoding, so that
+// msgpack:"..." tags work alongside the codec defaults.
+var structTagKeys = []string{"codec", "msgpack", "json"}
+
+var typeInfos = codec.NewTypeInfos(structTagKeys)
+
+// stringifyKeys rewrites every map in a schema-less decoded value so its
+// keys are strings, descending into nested maps and arrays.
+func stringifyKeys(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[keyString(k)] = stringifyKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = stringifyKeys(e)
+		}
+		return x
+	case []interface{}:
+		for i, e := range x {
+			x[i] = stringifyKeys(e)
+		}
+		return x
+	}
+	return v
+}
+
+func keyString(k interface{}) string {
+	switch x := k.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(k)
+}
+
+// validStrings reports whether every string reachable from v, including
+// map keys and exported struct fields, is valid UTF-8.
+func validStrings(v interface{}) bool {
+	return validStringsValue(reflect.ValueOf(v), 0)
+}
+
+func validStringsValue(rv reflect.Value, depth int) bool {
+	if !rv.IsValid() || depth > 64 {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return utf8.ValidString(rv.String())
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil() || validStringsValue(rv.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return true // binary, not text
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if !validStringsValue(rv.Index(i), depth+1) {
+				return false
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if !validStringsValue(iter.Key(), depth+1) || !validStringsValue(iter.Value(), depth+1) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < rv.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue // unexported fields are not encoded
+			}
+			if !validStringsValue(rv.Field(i), depth+1) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// wireParams returns the value sent as the params array. A single struct
+// tagged toarray, via a `_struct struct{} msgpack:",toarray"` field, is
+// sent as the params array itself, one element per field in declaration
+// order; anything else is sent as given.
+func wireParams(params []interface{}) interface{} {
+	if len(params) == 1 && isToArray(params[0]) {
+		return params[0]
+	}
+	return params
+}
+
+func isToArray(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return false
+	}
+	return isToArrayType(t)
+}
+
+func isToArrayType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	f, ok := t.FieldByName("_struct")
+	if !ok {
+		return false
+	}
+	for _, key := range structTagKeys {
+		if tag := f.Tag.Get(key); tag != "" {
+			for _, opt := range strings.Split(tag, ",")[1:] {
+				if opt == "toarray" {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
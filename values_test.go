@@ -0,0 +1,35 @@
+package endpoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Maps int
+
+func (*Maps) Nested(_ int, reply *map[int]interface{}) error {
+	*reply = map[int]interface{}{
+		1: "one",
+		2: map[int]string{3: "three"},
+	}
+	return nil
+}
+
+func TestStringMapKeys(t *testing.T) {
+	c, _ := newPair(t, new(Maps), nil, WithStringMapKeys())
+	rsp, err := c.Call("Maps.Nested", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := rsp.(map[string]interface{})
+	if !ok {
+		t.Fatalf("rsp is %T, want map[string]interface{}", rsp)
+	}
+	if s, _ := m["1"].([]byte); string(s) != "one" {
+		t.Fatalf(`m["1"] = %v`, m["1"])
+	}
+	inner, ok := m["2"].(map[string]interface{})
+	if !ok || len(inner) != 1 || !reflect.DeepEqual(inner["3"], []byte("three")) {
+		t.Fatalf(`m["2"] = %#v`, m["2"])
+	}
+}
@@ -0,0 +1,145 @@
+package endpoint
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortHeader = errors.New("rpc: truncated msgpack header")
+
+// readArrayLen parses a msgpack array header at b, returning its length
+// and the bytes following it.
+func readArrayLen(b []byte) (n int, rest []byte, err error) {
+	if len(b) == 0 {
+		err = errShortHeader
+		return
+	}
+	c := b[0]
+	switch {
+	case c >= 0x90 && c <= 0x9f:
+		return int(c & 0x0f), b[1:], nil
+	case c == 0xdc:
+		if len(b) < 3 {
+			break
+		}
+		return int(binary.BigEndian.Uint16(b[1:])), b[3:], nil
+	case c == 0xdd:
+		if len(b) < 5 {
+			break
+		}
+		return int(binary.BigEndian.Uint32(b[1:])), b[5:], nil
+	default:
+		err = errors.New("rpc: message is not an array")
+		return
+	}
+	err = errShortHeader
+	return
+}
+
+// readUint parses a non-negative msgpack integer at b.
+func readUint(b []byte) (v uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		err = errShortHeader
+		return
+	}
+	c := b[0]
+	size := 0
+	switch {
+	case c <= 0x7f:
+		return uint64(c), b[1:], nil
+	case c == 0xcc, c == 0xd0:
+		size = 1
+	case c == 0xcd, c == 0xd1:
+		size = 2
+	case c == 0xce, c == 0xd2:
+		size = 4
+	case c == 0xcf, c == 0xd3:
+		size = 8
+	default:
+		err = errors.New("rpc: expected an integer")
+		return
+	}
+	if len(b) < 1+size {
+		err = errShortHeader
+		return
+	}
+	switch size {
+	case 1:
+		v = uint64(b[1])
+	case 2:
+		v = uint64(binary.BigEndian.Uint16(b[1:]))
+	case 4:
+		v = uint64(binary.BigEndian.Uint32(b[1:]))
+	case 8:
+		v = binary.BigEndian.Uint64(b[1:])
+	}
+	return v, b[1+size:], nil
+}
+
+// readStrLen parses a msgpack str or bin header at b, returning the length
+// of the payload that follows.
+func readStrLen(b []byte) (n int, rest []byte, err error) {
+	if len(b) == 0 {
+		err = errShortHeader
+		return
+	}
+	c := b[0]
+	size := 0
+	switch {
+	case c >= 0xa0 && c <= 0xbf:
+		return int(c & 0x1f), b[1:], nil
+	case c == 0xd9, c == 0xc4:
+		size = 1
+	case c == 0xda, c == 0xc5:
+		size = 2
+	case c == 0xdb, c == 0xc6:
+		size = 4
+	default:
+		err = errors.New("rpc: expected a string")
+		return
+	}
+	if len(b) < 1+size {
+		err = errShortHeader
+		return
+	}
+	switch size {
+	case 1:
+		n = int(b[1])
+	case 2:
+		n = int(binary.BigEndian.Uint16(b[1:]))
+	case 4:
+		n = int(binary.BigEndian.Uint32(b[1:]))
+	}
+	return n, b[1+size:], nil
+}
+
+// peekMethodLen reports the length of the method name of a request or
+// notification frame by reading headers only, without decoding the name.
+// ok is false for responses and for frames it cannot parse.
+func peekMethodLen(msg []byte) (typ int, msgid uint32, n int, ok bool) {
+	_, b, err := readArrayLen(msg)
+	if err != nil {
+		return
+	}
+	t, b, err := readUint(b)
+	if err != nil {
+		return
+	}
+	typ = int(t)
+	switch typ {
+	case msgpackRPCReq:
+		var id uint64
+		if id, b, err = readUint(b); err != nil {
+			return
+		}
+		msgid = uint32(id)
+	case msgpackRPCNotify:
+	default:
+		return
+	}
+	if n, _, err = readStrLen(b); err != nil {
+		return
+	}
+	ok = true
+	return
+}
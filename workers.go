@@ -0,0 +1,129 @@
+package endpoint
+
+import (
+	"sync"
+)
+
+// WorkerPool runs handlers for many connections on a fixed number of
+// goroutines. Every connection gets its own bounded queue (a leaky bucket
+// drained by the workers) and the workers take from the queues in turn, so
+// a connection flooding requests only fills its own bucket and cannot
+// starve the others.
+type WorkerPool struct {
+	mu     sync.Mutex
+	work   *sync.Cond
+	queues []*workQueue
+	next   int
+	closed bool
+}
+
+type workQueue struct {
+	pool   *WorkerPool
+	budget int
+	jobs   []func()
+	space  *sync.Cond
+	closed bool
+}
+
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &WorkerPool{}
+	p.work = sync.NewCond(&p.mu)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+// Close stops the workers once the queued requests have been run.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.work.Broadcast()
+}
+
+func (p *WorkerPool) queue(budget int) *workQueue {
+	if budget <= 0 {
+		budget = 1
+	}
+	q := &workQueue{pool: p, budget: budget}
+	q.space = sync.NewCond(&p.mu)
+	p.mu.Lock()
+	p.queues = append(p.queues, q)
+	p.mu.Unlock()
+	return q
+}
+
+func (p *WorkerPool) run() {
+	p.mu.Lock()
+	for {
+		fn := p.take()
+		if fn == nil {
+			if p.closed {
+				p.mu.Unlock()
+				return
+			}
+			p.work.Wait()
+			continue
+		}
+		p.mu.Unlock()
+		fn()
+		p.mu.Lock()
+	}
+}
+
+// take pops the next job, visiting the queues round-robin. p.mu must be held.
+func (p *WorkerPool) take() func() {
+	n := len(p.queues)
+	for i := 0; i < n; i++ {
+		idx := (p.next + i) % n
+		q := p.queues[idx]
+		if len(q.jobs) == 0 {
+			continue
+		}
+		fn := q.jobs[0]
+		q.jobs[0] = nil
+		q.jobs = q.jobs[1:]
+		p.next = idx + 1
+		q.space.Signal()
+		return fn
+	}
+	return nil
+}
+
+// submit queues fn, waiting while the connection's bucket is full. It
+// reports false if the queue or the pool has been closed.
+func (q *workQueue) submit(fn func()) bool {
+	p := q.pool
+	p.mu.Lock()
+	for len(q.jobs) >= q.budget && !q.closed && !p.closed {
+		q.space.Wait()
+	}
+	if q.closed || p.closed {
+		p.mu.Unlock()
+		return false
+	}
+	q.jobs = append(q.jobs, fn)
+	p.mu.Unlock()
+	p.work.Signal()
+	return true
+}
+
+// release removes the queue from the pool, dropping requests not yet run.
+func (q *workQueue) release() {
+	p := q.pool
+	p.mu.Lock()
+	q.closed = true
+	q.jobs = nil
+	for i, other := range p.queues {
+		if other == q {
+			p.queues = append(p.queues[:i], p.queues[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	q.space.Broadcast()
+}
@@ -0,0 +1,44 @@
+package endpoint
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Sleeper int
+
+func (*Sleeper) Sleep(d int64, reply *int) error {
+	time.Sleep(time.Duration(d))
+	return nil
+}
+
+func TestWorkerPoolFairness(t *testing.T) {
+	pool := NewWorkerPool(1)
+	defer pool.Close()
+	flooder, _ := newPair(t, new(Sleeper), []Option{WithWorkerPool(pool, 4)})
+	other, _ := newPair(t, new(Sleeper), []Option{WithWorkerPool(pool, 4)})
+
+	const flood = 50
+	var done int32
+	var wg sync.WaitGroup
+	for i := 0; i < flood; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flooder.Call("Sleeper.Sleep", int64(2*time.Millisecond))
+			atomic.AddInt32(&done, 1)
+		}()
+	}
+	waitFor(t, "the flood to start", func() bool { return atomic.LoadInt32(&done) > 0 })
+	if _, err := other.Call("Sleeper.Sleep", int64(0)); err != nil {
+		t.Fatal(err)
+	}
+	// With the worker taking turns, the quiet connection waits for at most
+	// a few of the flooder's requests, not the whole flood.
+	if n := atomic.LoadInt32(&done); n > flood/2 {
+		t.Fatalf("quiet connection served after %d of %d flood requests", n, flood)
+	}
+	wg.Wait()
+}